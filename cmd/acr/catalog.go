@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	pageSizeStr = "pagesize"
+	timeoutStr  = "timeout"
+	intervalStr = "interval"
+)
+
+var (
+	checkCatalogFlags = []cli.Flag{
+		&cli.IntFlag{
+			Name:  pageSizeStr,
+			Usage: "number of repositories to request per catalog page",
+		},
+		&cli.DurationFlag{
+			Name:  timeoutStr,
+			Usage: "maximum time to wait for the new repository to appear in the catalog",
+			Value: 5 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:  intervalStr,
+			Usage: "time to wait between catalog listings",
+			Value: 5 * time.Second,
+		},
+	}
+
+	checkCatalogCommand = &cli.Command{
+		Name:      "check-catalog",
+		Usage:     "check that a new repository becomes visible in the _catalog API",
+		ArgsUsage: "<login-server>",
+		Flags:     append(commonFlags, checkCatalogFlags...),
+		Action:    runCheckCatalog,
+	}
+)
+
+func runCheckCatalog(ctx *cli.Context) (err error) {
+	proxy, err := proxy(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = proxy.Ping()
+	if err != nil {
+		return err
+	}
+
+	err = proxy.CheckCatalog(registry.CatalogOptions{
+		PageSize: ctx.Int(pageSizeStr),
+		Timeout:  ctx.Duration(timeoutStr),
+		Interval: ctx.Duration(intervalStr),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
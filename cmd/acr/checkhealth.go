@@ -1,14 +1,61 @@
 package main
 
-import "github.com/urfave/cli/v2"
-
-var checkHealthCommand = &cli.Command{
-	Name:      "check-health",
-	Usage:     "check health of registry endpoints",
-	ArgsUsage: "<login-server>",
-	Flags:     commonFlags,
-	Action:    runCheckHealth,
-}
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	platformsStr   = "platforms"
+	dockerStr      = "docker"
+	layersStr      = "layers"
+	layerSizeStr   = "layersize"
+	compressionStr = "compression"
+	annotationStr  = "annotation"
+)
+
+var (
+	checkHealthFlags = []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  platformsStr,
+			Usage: "push an image index with an image per platform, such as linux/amd64,linux/arm64",
+		},
+		&cli.BoolFlag{
+			Name:  dockerStr,
+			Usage: "also push Docker schema2 manifests and manifest lists, and report media type compatibility",
+		},
+		&cli.IntFlag{
+			Name:  layersStr,
+			Usage: "generate images with this many tar layers instead of the default synthetic image",
+			Value: 1,
+		},
+		&cli.Int64Flag{
+			Name:  layerSizeStr,
+			Usage: "size in bytes of the random file in each generated layer",
+			Value: 1024,
+		},
+		&cli.StringFlag{
+			Name:  compressionStr,
+			Usage: "compression of generated layers: none, gzip or zstd",
+			Value: registry.CompressionGzip,
+		},
+		&cli.StringSliceFlag{
+			Name:  annotationStr,
+			Usage: "add a key=value annotation to generated image manifests",
+		},
+	}
+
+	checkHealthCommand = &cli.Command{
+		Name:      "check-health",
+		Usage:     "check health of registry endpoints",
+		ArgsUsage: "<login-server>",
+		Flags:     append(commonFlags, checkHealthFlags...),
+		Action:    runCheckHealth,
+	}
+)
 
 func runCheckHealth(ctx *cli.Context) (err error) {
 	proxy, err := proxy(ctx)
@@ -21,10 +68,58 @@ func runCheckHealth(ctx *cli.Context) (err error) {
 		return err
 	}
 
-	err = proxy.CheckHealth()
+	opts, err := healthOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = proxy.CheckHealth(opts)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// healthOptions returns the check-health options set by the context flags.
+func healthOptions(ctx *cli.Context) (opts registry.HealthOptions, err error) {
+	opts.Docker = ctx.Bool(dockerStr)
+	for _, value := range ctx.StringSlice(platformsStr) {
+		for _, specifier := range strings.Split(value, ",") {
+			platform, err := registry.ParsePlatform(strings.TrimSpace(specifier))
+			if err != nil {
+				return opts, err
+			}
+			opts.Platforms = append(opts.Platforms, platform)
+		}
+	}
+
+	opts.Image, err = imageSpec(ctx)
+	return opts, err
+}
+
+// imageSpec returns the shape of generated images, or nil if none of the image shape flags are set.
+func imageSpec(ctx *cli.Context) (*registry.ImageSpec, error) {
+	if !ctx.IsSet(layersStr) && !ctx.IsSet(layerSizeStr) && !ctx.IsSet(compressionStr) && !ctx.IsSet(annotationStr) {
+		return nil, nil
+	}
+
+	spec := &registry.ImageSpec{
+		Layers:      ctx.Int(layersStr),
+		LayerSize:   ctx.Int64(layerSizeStr),
+		Compression: ctx.String(compressionStr),
+	}
+
+	for _, annotation := range ctx.StringSlice(annotationStr) {
+		parts := strings.SplitN(annotation, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid annotation %q, expected key=value", annotation)
+		}
+		if spec.Annotations == nil {
+			spec.Annotations = map[string]string{}
+		}
+		spec.Annotations[parts[0]] = parts[1]
+	}
+
+	return spec, nil
+}
@@ -6,21 +6,30 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 
+	"github.com/aviral26/acr-checkhealth/pkg/har"
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+	"github.com/aviral26/acr-checkhealth/pkg/metrics"
 	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/aviral26/acr-checkhealth/pkg/report"
 	"github.com/rs/zerolog"
 	"github.com/urfave/cli/v2"
 )
 
 // Common flag names
 const (
-	insecureStr       = "insecure"
-	basicAuthStr      = "basicauth"
-	userNameStr       = "username"
-	passwordStr       = "password"
-	dataEndpointStr   = "dataendpoint"
-	traceStr          = "trace"
+	insecureStr     = "insecure"
+	basicAuthStr    = "basicauth"
+	userNameStr     = "username"
+	passwordStr     = "password"
+	dataEndpointStr = "dataendpoint"
+	traceStr        = "trace"
+	metricsFileStr  = "metrics-file"
+	otlpEndpointStr = "otlp-endpoint"
+	harStr          = "har"
+	reportStr       = "report"
 )
 
 // commonFlags is a collection of cli flags common to all commands.
@@ -48,14 +57,45 @@ var commonFlags = []cli.Flag{
 		Name:  basicAuthStr,
 		Usage: "use basic auth mode for data operations",
 	},
+	&cli.StringFlag{
+		Name:  metricsFileStr,
+		Usage: "write Prometheus metrics to a file, such as for the node_exporter textfile collector",
+	},
+	&cli.StringFlag{
+		Name:    otlpEndpointStr,
+		Usage:   "export OpenTelemetry traces with OTLP over HTTP to this collector URL, such as http://localhost:4318",
+		EnvVars: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"},
+	},
+	&cli.StringFlag{
+		Name:  harStr,
+		Usage: "write all HTTP traffic to a HAR file, with credentials redacted",
+	},
+	&cli.StringFlag{
+		Name:  reportStr,
+		Usage: "write a JSON report of the run, which can be compared with another by the compare command",
+	},
 }
 
 var (
 	logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
+
+	// collector collects the metrics of all proxies.
+	collector = metrics.NewCollector()
+
+	// recorder records the HTTP traffic of all proxies when a HAR file is specified.
+	recorder = har.NewRecorder()
+
+	// reporter records the steps, requests and network facts of all proxies when a report is specified.
+	reporter = report.NewRecorder()
 )
 
 // proxy creates an new proxy instance from context specific arguments and flags.
 func proxy(ctx *cli.Context) (*registry.Proxy, error) {
+	return proxyFor(ctx, ctx.Args().First())
+}
+
+// proxyFor creates a new proxy instance for the given login server from context specific flags.
+func proxyFor(ctx *cli.Context, loginServer string) (*registry.Proxy, error) {
 	if ctx.Bool(traceStr) {
 		logger = logger.With().Logger().Level(zerolog.TraceLevel)
 	} else {
@@ -67,12 +107,12 @@ func proxy(ctx *cli.Context) (*registry.Proxy, error) {
 		return nil, err
 	}
 
-	loginServer, dataEndpoint, err := resolveAll(ctx)
+	loginServer, dataEndpoint, err := resolveAll(ctx, loginServer)
 	if err != nil {
 		return nil, err
 	}
 
-	return registry.NewProxy(http.DefaultTransport,
+	proxy, err := registry.NewProxy(http.DefaultTransport,
 		&registry.Options{
 			LoginServer:   loginServer,
 			Username:      username,
@@ -82,6 +122,19 @@ func proxy(ctx *cli.Context) (*registry.Proxy, error) {
 			BasicAuthMode: basicAuthMode,
 		},
 		logger)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy.RoundTripper = rhttp.Observe(proxy.RoundTripper, collector.Observer(loginServer))
+	if ctx.String(harStr) != "" {
+		proxy.RoundTripper = rhttp.Observe(proxy.RoundTripper, recorder.Observe)
+	}
+	if ctx.String(reportStr) != "" {
+		proxy.RoundTripper = rhttp.Observe(proxy.RoundTripper, reporter.ObserveRoundTrip)
+	}
+	proxy.Span = commandSpan
+	return proxy, nil
 }
 
 // getAuth gets authentication information from context.
@@ -108,11 +161,11 @@ func getAuth(ctx *cli.Context) (username, password string, basicAuthMode bool, e
 	return username, password, basicAuthMode, nil
 }
 
-// resolveAll attempts to resolve the endpoints specified in the context.
-func resolveAll(ctx *cli.Context) (loginServer, dataEndpoint string, err error) {
+// resolveAll attempts to resolve the login server and the endpoints specified in the context.
+func resolveAll(ctx *cli.Context, loginServer string) (_, dataEndpoint string, err error) {
 	hostnames := []string{}
 
-	if loginServer = ctx.Args().First(); loginServer == "" {
+	if loginServer == "" {
 		return loginServer, dataEndpoint, errors.New("login server name required")
 	}
 
@@ -155,12 +208,24 @@ func resolve(hostname string) error {
 		cur = cname
 	}
 
-	ip, err := net.LookupIP(cur)
+	ips, err := net.LookupIP(cur)
 	if err != nil {
 		return err
 	}
-	path = append(path, ip[0].String())
+
+	// All addresses are recorded, sorted, so that runs resolving the same set of addresses compare equal.
+	seen := map[string]bool{}
+	addrs := []string{}
+	for _, ip := range ips {
+		if addr := ip.String(); !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	path = append(path, strings.Join(addrs, ", "))
 
 	logger.Info().Msg(fmt.Sprintf("DNS:  %v", strings.Join(path, " -> ")))
+	reporter.ObserveDNS(hostname, path)
 	return nil
 }
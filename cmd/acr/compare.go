@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/report"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	maxLatencyIncreaseStr  = "max-latency-increase"
+	minLatencyDeltaStr     = "min-latency-delta"
+	failOnStatusChangeStr  = "fail-on-status-change"
+	failOnNetworkChangeStr = "fail-on-network-change"
+)
+
+var (
+	compareFlags = []cli.Flag{
+		&cli.Float64Flag{
+			Name:  maxLatencyIncreaseStr,
+			Usage: "maximum increase of the mean latency of a step in percent",
+			Value: 50,
+		},
+		&cli.DurationFlag{
+			Name:  minLatencyDeltaStr,
+			Usage: "minimum increase of the mean latency of a step to be a regression",
+			Value: 50 * time.Millisecond,
+		},
+		&cli.BoolFlag{
+			Name:  failOnStatusChangeStr,
+			Usage: "fail if the status codes of any operation changed",
+		},
+		&cli.BoolFlag{
+			Name:  failOnNetworkChangeStr,
+			Usage: "fail if the DNS, IP or TLS facts of any host changed",
+		},
+	}
+
+	compareCommand = &cli.Command{
+		Name:      "compare",
+		Usage:     "compare the report of a run with a baseline report and fail on regressions",
+		ArgsUsage: "<baseline-report> <report>",
+		Flags:     compareFlags,
+		Action:    runCompare,
+	}
+)
+
+func runCompare(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("baseline report and report required")
+	}
+
+	baseline, err := report.ReadFile(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	current, err := report.ReadFile(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	if baseline.Command != current.Command {
+		return fmt.Errorf("cannot compare a report of %v with a baseline of %v", current.Command, baseline.Command)
+	}
+
+	c := report.Compare(baseline, current, report.Thresholds{
+		LatencyIncrease: ctx.Float64(maxLatencyIncreaseStr) / 100,
+		MinLatencyDelta: ctx.Duration(minLatencyDeltaStr),
+		StatusCodes:     ctx.Bool(failOnStatusChangeStr),
+		Network:         ctx.Bool(failOnNetworkChangeStr),
+	})
+
+	fmt.Printf("Baseline: %v %v at %v, version %v\n", baseline.Command, baseline.LoginServer, baseline.StartedAt.Format(time.RFC3339), baseline.Version)
+	fmt.Printf("Current:  %v %v at %v, version %v\n", current.Command, current.LoginServer, current.StartedAt.Format(time.RFC3339), current.Version)
+
+	printStepDeltas(c.Steps)
+	printStatusChanges(c.StatusChanges)
+	printNetworkChanges(c.NetworkChanges)
+
+	if c.Passed() {
+		fmt.Println("\nNo regressions")
+		return nil
+	}
+
+	fmt.Println("\nREGRESSIONS")
+	for _, regression := range c.Regressions {
+		fmt.Printf("  %v\n", regression)
+	}
+	return fmt.Errorf("%v regressions against the baseline", len(c.Regressions))
+}
+
+// printStepDeltas prints the mean latency of each step in both runs.
+func printStepDeltas(steps []report.StepDelta) {
+	if len(steps) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nSTEP\tBASELINE\tCURRENT\tDELTA\tSTATUS")
+	for _, step := range steps {
+		baseline, current, delta := "-", "-", "-"
+		if step.Baseline != nil {
+			baseline = time.Duration(step.Baseline.Mean).Round(time.Microsecond).String()
+		}
+		if step.Current != nil {
+			current = time.Duration(step.Current.Mean).Round(time.Microsecond).String()
+		}
+		if step.Baseline != nil && step.Current != nil {
+			delta = time.Duration(step.Delta).Round(time.Microsecond).String()
+			if step.Delta > 0 {
+				delta = "+" + delta
+			}
+			if step.Ratio > 0 {
+				delta += fmt.Sprintf(" (%+.0f%%)", (step.Ratio-1)*100)
+			}
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", step.Name, baseline, current, delta, stepStatus(step))
+	}
+	w.Flush()
+}
+
+// stepStatus describes how a step changed.
+func stepStatus(step report.StepDelta) string {
+	var status []string
+	switch {
+	case step.Baseline == nil:
+		status = append(status, "new")
+	case step.Current == nil:
+		status = append(status, "not run")
+	}
+	if step.NewFailure {
+		status = append(status, "newly failing")
+	} else if step.Current != nil && step.Current.Failures > 0 {
+		status = append(status, "failing")
+	}
+	if step.Regression {
+		status = append(status, "slower")
+	}
+
+	if len(status) == 0 {
+		return "ok"
+	}
+	return strings.Join(status, ", ")
+}
+
+// printStatusChanges prints the status codes that only one of the runs got, by operation.
+func printStatusChanges(changes []report.StatusChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nOPERATION\tADDED CODES\tREMOVED CODES")
+	for _, change := range changes {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", change.Operation, orNone(strings.Join(change.Added, ", ")), orNone(strings.Join(change.Removed, ", ")))
+	}
+	w.Flush()
+}
+
+// printNetworkChanges prints the changed network facts of each host.
+func printNetworkChanges(changes []report.NetworkChange) {
+	if len(changes) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nHOST\tFACT\tBASELINE\tCURRENT")
+	for _, change := range changes {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", change.Host, change.Fact, orNone(change.Baseline), orNone(change.Current))
+	}
+	w.Flush()
+}
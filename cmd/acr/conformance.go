@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	conformanceCommand = &cli.Command{
+		Name:      "check-conformance",
+		Usage:     "check conformance with the OCI distribution-spec pull, push, content discovery and content management requirements",
+		ArgsUsage: "<login-server>",
+		Flags:     commonFlags,
+		Action:    runCheckConformance,
+	}
+)
+
+func runCheckConformance(ctx *cli.Context) (err error) {
+	proxy, err := proxy(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = proxy.Ping()
+	if err != nil {
+		return err
+	}
+
+	results, err := proxy.CheckConformance()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nOUTCOME\tCATEGORY\tSECTION\tREQUIREMENT\tERROR CODES\tREASON")
+	for _, result := range results {
+		reason := result.Reason
+		if result.ErrorCategory != "" {
+			reason = fmt.Sprintf("[%v] %v", result.ErrorCategory, reason)
+		}
+		fmt.Fprintf(w, "%v\t%v\t#%v\t%v\t%v\t%v\n", result.Outcome, result.Category, result.Section, result.Requirement, strings.Join(result.ErrorCodes, ", "), reason)
+
+		if result.Request != nil {
+			recordFailedRequest(*result.Request)
+		}
+	}
+	w.Flush()
+	fmt.Printf("\nSections refer to %v\n", registry.SpecURL)
+
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+)
+
+// failedRequests are the requests that caused the failures of the command, in order.
+var failedRequests []registry.RequestInfo
+
+// recordFailure records the request that caused err, if known.
+func recordFailure(err error) {
+	if request, ok := registry.FailedRequest(err); ok {
+		recordFailedRequest(request)
+	}
+}
+
+// recordFailedRequest records a failed request, unless it was already recorded.
+func recordFailedRequest(request registry.RequestInfo) {
+	for _, recorded := range failedRequests {
+		if recorded == request {
+			return
+		}
+	}
+	failedRequests = append(failedRequests, request)
+}
+
+// printFailedRequests prints the failed requests with their correlation and request IDs, so that they can
+// be filed with the registry operator.
+func printFailedRequests() {
+	if len(failedRequests) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nFAILED REQUEST\tSTATUS\tCORRELATION ID\tREQUEST ID\tAPI VERSION")
+	for _, request := range failedRequests {
+		fmt.Fprintf(w, "%v %v\t%v\t%v\t%v\t%v\n", request.Method, request.URL, orNone(request.StatusCode),
+			orNone(request.CorrelationID), orNone(request.RequestID), orNone(request.APIVersion))
+	}
+	w.Flush()
+}
+
+// orNone returns v, or "-" if v is the zero value.
+func orNone(v interface{}) interface{} {
+	switch v {
+	case "", 0:
+		return "-"
+	}
+	return v
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
+	"github.com/urfave/cli/v2"
+)
+
+// serviceName identifies the checks in exported traces.
+const serviceName = "acr-checkhealth"
+
+var (
+	// tracer exports traces when an OTLP endpoint is specified, and records steps when a report is
+	// specified.
+	tracer *tracing.Tracer
+
+	// commandSpan is the root span of the command, and the parent of the spans of every proxy.
+	commandSpan *tracing.Span
+)
+
+// instrument traces cmd and records its outcome as a check against its login server, then writes the
+// metrics, HAR and report files and exports the traces when requested. Failed requests are summarized at the end.
+func instrument(cmd *cli.Command) {
+	action := cmd.Action
+	cmd.Action = func(ctx *cli.Context) error {
+		loginServer := ctx.Args().First()
+
+		tracer = newTracer(ctx)
+		commandSpan = tracer.Start(cmd.Name)
+		commandSpan.SetAttribute("acr.login_server", loginServer)
+
+		start := time.Now()
+		err := action(ctx)
+
+		if loginServer != "" {
+			collector.ObserveCheck(loginServer, cmd.Name, err == nil, start, time.Since(start))
+		}
+		writeMetricsFile(ctx)
+		writeHARFile(ctx)
+
+		endSpan(commandSpan, err)
+		flushTraces()
+
+		recordFailure(err)
+		writeReport(ctx, cmd.Name, loginServer, start, err)
+		printFailedRequests()
+
+		return err
+	}
+}
+
+// newTracer returns a tracer exporting to the OTLP endpoint and recording steps for the report, or nil if
+// neither is specified.
+func newTracer(ctx *cli.Context) *tracing.Tracer {
+	var exporter *tracing.Exporter
+	if endpoint := ctx.String(otlpEndpointStr); endpoint != "" {
+		exporter = tracing.NewExporter(endpoint, serviceName, Version)
+	}
+
+	reporting := ctx.String(reportStr) != ""
+	if exporter == nil && !reporting {
+		return nil
+	}
+
+	t := tracing.NewTracer(exporter)
+	if reporting {
+		t.OnEnd = reporter.ObserveSpan
+	}
+	return t
+}
+
+// endSpan ends a root span with the category of err, if any.
+func endSpan(span *tracing.Span, err error) {
+	if err != nil {
+		span.SetAttribute("acr.error_category", string(registry.Classify(err)))
+	}
+	span.End(err)
+}
+
+// writeMetricsFile writes the collected metrics to the metrics file, if one is specified. Failures are
+// logged rather than returned, so that they do not mask the outcome of checks.
+func writeMetricsFile(ctx *cli.Context) {
+	path := ctx.String(metricsFileStr)
+	if path == "" {
+		return
+	}
+
+	if err := collector.WriteFile(path); err != nil {
+		logger.Warn().Msg(fmt.Sprintf("failed to write metrics file %v: %v", path, err))
+	}
+}
+
+// writeHARFile writes the recorded HTTP traffic to the HAR file, if one is specified. Failures are logged
+// rather than returned, so that they do not mask the outcome of checks.
+func writeHARFile(ctx *cli.Context) {
+	path := ctx.String(harStr)
+	if path == "" {
+		return
+	}
+
+	if err := recorder.WriteFile(path, serviceName, Version); err != nil {
+		logger.Warn().Msg(fmt.Sprintf("failed to write HAR file %v: %v", path, err))
+	}
+}
+
+// flushTraces exports the ended spans, if tracing. Failures are logged rather than returned, so that they do
+// not mask the outcome of checks.
+func flushTraces() {
+	if err := tracer.Flush(); err != nil {
+		logger.Warn().Msg(fmt.Sprintf("failed to export traces: %v", err))
+	}
+}
+
+// writeReport writes the report of a run of command against loginServer, if a report is specified. Failures
+// are logged rather than returned, so that they do not mask the outcome of checks.
+func writeReport(ctx *cli.Context, command, loginServer string, start time.Time, err error) {
+	path := ctx.String(reportStr)
+	if path == "" {
+		return
+	}
+
+	r := reporter.Report(command, loginServer, Version, start, err, failedRequests)
+	if writeErr := r.WriteFile(path); writeErr != nil {
+		logger.Warn().Msg(fmt.Sprintf("failed to write report %v: %v", path, writeErr))
+	}
+}
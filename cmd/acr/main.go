@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
 	"github.com/urfave/cli/v2"
 )
 
@@ -31,10 +32,25 @@ func main() {
 			pingCommand,
 			checkHealthCommand,
 			referrersCommand,
+			checkCatalogCommand,
+			pushImageCommand,
+			pullImageCommand,
+			conformanceCommand,
+			monitorCommand,
+			compareCommand,
 		},
 	}
 
+	// The monitor records the outcome of each of its check runs instead, and compare runs no checks.
+	for _, cmd := range app.Commands {
+		if cmd != monitorCommand && cmd != compareCommand {
+			instrument(cmd)
+		}
+	}
+
 	if err := app.Run(os.Args); err != nil {
-		logger.Fatal().Msg(err.Error())
+		category := registry.Classify(err)
+		logger.Error().Str("category", string(category)).Msg(err.Error())
+		os.Exit(category.ExitCode())
 	}
 }
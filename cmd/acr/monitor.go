@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/monitor"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	jitterStr      = "jitter"
+	windowStr      = "window"
+	metricsAddrStr = "metrics-addr"
+	healthAddrStr  = "health-addr"
+
+	// monitorHAREntries is the number of most recent requests kept in the HAR file of a monitor.
+	monitorHAREntries = 1000
+)
+
+var (
+	monitorFlags = []cli.Flag{
+		&cli.DurationFlag{
+			Name:  intervalStr,
+			Usage: "average time between check runs against each registry",
+			Value: time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:  jitterStr,
+			Usage: "maximum random deviation from the interval",
+			Value: 10 * time.Second,
+		},
+		&cli.IntFlag{
+			Name:  windowStr,
+			Usage: "number of recent runs used for success rates and latencies",
+			Value: 60,
+		},
+		&cli.StringFlag{
+			Name:  metricsAddrStr,
+			Usage: "serve Prometheus metrics at /metrics on this address, such as :9090",
+		},
+		&cli.StringFlag{
+			Name:  healthAddrStr,
+			Usage: "serve the latest check results as JSON at /healthz on this address, such as :8080, with status 503 when unhealthy",
+		},
+	}
+
+	monitorCommand = &cli.Command{
+		Name:      "monitor",
+		Usage:     "run ping and check-health against registries on a schedule until interrupted",
+		ArgsUsage: "<login-server> [<login-server>...]",
+		Flags:     append(append(commonFlags, checkHealthFlags...), monitorFlags...),
+		Action:    runMonitor,
+	}
+)
+
+func runMonitor(ctx *cli.Context) (err error) {
+	if ctx.NArg() == 0 {
+		return errors.New("login server name required")
+	}
+
+	opts := monitor.Options{
+		Interval: ctx.Duration(intervalStr),
+		Jitter:   ctx.Duration(jitterStr),
+		Window:   ctx.Int(windowStr),
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("--%v must be positive", intervalStr)
+	}
+	if opts.Jitter < 0 || opts.Jitter >= opts.Interval {
+		return fmt.Errorf("--%v must be at least 0 and less than --%v", jitterStr, intervalStr)
+	}
+	opts.Health, err = healthOptions(ctx)
+	if err != nil {
+		return err
+	}
+	recorder.Limit = monitorHAREntries
+	opts.Tracer = newTracer(ctx)
+	tracer = opts.Tracer
+	opts.OnResult = func(target, check string, result monitor.Result) {
+		collector.ObserveCheck(target, check, result.OK(), result.Time, result.Duration)
+		writeMetricsFile(ctx)
+		writeHARFile(ctx)
+		flushTraces()
+	}
+
+	var targets []monitor.Target
+	for _, loginServer := range ctx.Args().Slice() {
+		proxy, err := proxyFor(ctx, loginServer)
+		if err != nil {
+			return err
+		}
+
+		// Only results and failures are logged, unless tracing.
+		if !ctx.Bool(traceStr) {
+			proxy.Logger = proxy.Logger.Level(zerolog.WarnLevel)
+		}
+
+		targets = append(targets, monitor.Target{Name: loginServer, Proxy: proxy})
+	}
+
+	rand.Seed(time.Now().UnixNano())
+
+	// Stop on interrupt
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	m := monitor.New(targets, opts, logger)
+
+	// Endpoints on the same address share a server.
+	endpoints := make(map[string]map[string]http.Handler)
+	if addr := ctx.String(metricsAddrStr); addr != "" {
+		addEndpoint(endpoints, addr, "/metrics", collector)
+	}
+	if addr := ctx.String(healthAddrStr); addr != "" {
+		health := http.StripPrefix("/healthz", m)
+		addEndpoint(endpoints, addr, "/healthz", health)
+		addEndpoint(endpoints, addr, "/healthz/", health)
+	}
+	for addr, handlers := range endpoints {
+		stop, err := serve(addr, handlers)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	logger.Info().Msg(fmt.Sprintf("monitoring %v registries every %v ± %v", len(targets), opts.Interval, opts.Jitter))
+	start := time.Now()
+	m.Run(runCtx)
+	logger.Info().Msg("monitor stopped")
+
+	writeReport(ctx, ctx.Command.Name, strings.Join(ctx.Args().Slice(), ","), start, nil)
+
+	return nil
+}
+
+// addEndpoint adds a handler of a path to the endpoints served on addr.
+func addEndpoint(endpoints map[string]map[string]http.Handler, addr, path string, handler http.Handler) {
+	if endpoints[addr] == nil {
+		endpoints[addr] = make(map[string]http.Handler)
+	}
+	endpoints[addr][path] = handler
+}
+
+// serve serves the handlers by path on addr in the background. It returns a function to stop serving.
+func serve(addr string, handlers map[string]http.Handler) (func() error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	for _, path := range paths {
+		// Subtrees, such as /healthz/, are logged with their root.
+		if strings.HasSuffix(path, "/") {
+			continue
+		}
+		logger.Info().Msg(fmt.Sprintf("serving %v at http://%v%v", path, listener.Addr(), path))
+	}
+	return server.Close, nil
+}
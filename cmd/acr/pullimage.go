@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/aviral26/acr-checkhealth/pkg/layout"
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	outputStr = "output"
+)
+
+var (
+	pullImageFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    outputStr,
+			Aliases: []string{"o"},
+			Usage:   "OCI image layout directory to write the image to",
+			Value:   "image",
+		},
+	}
+
+	pullImageCommand = &cli.Command{
+		Name:      "pull-image",
+		Usage:     "pull an image, verify it and write it to an OCI image layout",
+		ArgsUsage: "<login-server> <repo>:<tag>|<repo>@<digest>",
+		Flags:     append(commonFlags, pullImageFlags...),
+		Action:    runPullImage,
+	}
+)
+
+func runPullImage(ctx *cli.Context) (err error) {
+	reference := ctx.Args().Get(1)
+	if reference == "" {
+		return errors.New("image reference required")
+	}
+
+	repo, tagOrDigest, err := registry.ParseReference(reference)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := proxy(ctx)
+	if err != nil {
+		return err
+	}
+
+	w, err := layout.NewWriter(ctx.String(outputStr))
+	if err != nil {
+		return err
+	}
+
+	err = proxy.Ping()
+	if err != nil {
+		return err
+	}
+
+	err = proxy.PullImage(repo, tagOrDigest, w)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
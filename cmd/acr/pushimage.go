@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aviral26/acr-checkhealth/pkg/layout"
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	imageStr  = "image"
+	nameStr   = "name"
+	targetStr = "target"
+)
+
+var (
+	pushImageFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:     imageStr,
+			Usage:    "path to an OCI image layout or docker save tarball",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  nameStr,
+			Usage: "image to push when the source holds more than one, such as busybox:latest",
+		},
+		&cli.StringFlag{
+			Name:  targetStr,
+			Usage: "target <repo>:<tag>, defaults to a new acrcheckhealth repository",
+		},
+	}
+
+	pushImageCommand = &cli.Command{
+		Name:      "push-image",
+		Usage:     "push an image from an OCI image layout or docker save tarball and verify it",
+		ArgsUsage: "<login-server>",
+		Flags:     append(commonFlags, pushImageFlags...),
+		Action:    runPushImage,
+	}
+)
+
+func runPushImage(ctx *cli.Context) (err error) {
+	proxy, err := proxy(ctx)
+	if err != nil {
+		return err
+	}
+
+	var repo, tag string
+	if target := ctx.String(targetStr); target != "" {
+		if strings.Contains(target, "@") {
+			return errors.New("target must be a <repo>:<tag>")
+		}
+		repo, tag, err = registry.ParseReference(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	image, err := layout.Open(ctx.String(imageStr), ctx.String(nameStr))
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	err = proxy.Ping()
+	if err != nil {
+		return err
+	}
+
+	err = proxy.PushImage(image, repo, tag)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
 	"github.com/urfave/cli/v2"
 )
 
 const (
 	referrersCountStr    = "referrers"
+	consistencyStr       = "consistency"
+	iterationsStr        = "iterations"
+	paginationStr        = "pagination"
+	concurrencyStr       = "concurrency"
 	OciReferrers         = "Referrers_OCI_V1"
 	OciManifestReferrers = "Referrers_OCI_Manifest"
 	OrasReferrers        = "Referrers_ORAS_V1"
@@ -20,6 +27,34 @@ var (
 			Usage: "number of referrers to create",
 			Value: 1,
 		},
+		&cli.BoolFlag{
+			Name:  paginationStr,
+			Usage: "only push --referrers referrers concurrently and verify every page of the referrers API",
+		},
+		&cli.IntFlag{
+			Name:  concurrencyStr,
+			Usage: "number of referrers pushed at a time when verifying pagination",
+			Value: 10,
+		},
+		&cli.BoolFlag{
+			Name:  consistencyStr,
+			Usage: "only measure the time until pushed referrers are visible and deleted referrers are gone",
+		},
+		&cli.IntFlag{
+			Name:  iterationsStr,
+			Usage: "number of referrers to push and delete when measuring consistency",
+			Value: 10,
+		},
+		&cli.DurationFlag{
+			Name:  intervalStr,
+			Usage: "time to wait between referrers queries when measuring consistency",
+			Value: 100 * time.Millisecond,
+		},
+		&cli.DurationFlag{
+			Name:  timeoutStr,
+			Usage: "maximum time to wait for a referrer to appear or disappear when measuring consistency",
+			Value: 30 * time.Second,
+		},
 	}
 
 	referrersCommand = &cli.Command{
@@ -32,6 +67,15 @@ var (
 )
 
 func runCheckReferrers(ctx *cli.Context) (err error) {
+	if ctx.Bool(consistencyStr) {
+		if ctx.Int(iterationsStr) <= 0 {
+			return fmt.Errorf("--%v must be positive", iterationsStr)
+		}
+		if ctx.Duration(intervalStr) <= 0 {
+			return fmt.Errorf("--%v must be positive", intervalStr)
+		}
+	}
+
 	proxy, err := proxy(ctx)
 	if err != nil {
 		return err
@@ -43,22 +87,90 @@ func runCheckReferrers(ctx *cli.Context) (err error) {
 	}
 	fmt.Print("\n----------------------------------------------TEST START-----------------------------------------------\n")
 
-	for _, version := range []string{OrasReferrers, OciManifestReferrers, OciReferrers} {
-		fmt.Printf("\n------------------------%s-------------------------\n", version)
-		fmt.Print("----ORDERED----\n")
+	// Every check runs even if an earlier one failed, and the first failure is returned.
+	var failure, versionFailure error
+	check := func(err error) {
+		if err == nil {
+			return
+		}
+		printError(err)
+		if failure == nil {
+			failure = err
+		}
+		if versionFailure == nil {
+			versionFailure = err
+		}
+	}
 
-		err = proxy.CheckReferrers(ctx.Int(referrersCountStr), version)
-		if err != nil {
-			fmt.Print(err)
+	// Checks of every referrers API version run under a span of the version, so that their steps are
+	// reported apart.
+	forEachVersion := func(run func(proxy registry.Proxy, version string)) {
+		for _, version := range []string{OrasReferrers, OciManifestReferrers, OciReferrers} {
+			fmt.Printf("\n------------------------%s-------------------------\n", version)
+
+			span := proxy.Span.Child(version, tracing.SpanKindInternal)
+			versionProxy := *proxy
+			if span != nil {
+				versionProxy.Span = span
+			}
+
+			versionFailure = nil
+			run(versionProxy, version)
+			span.End(versionFailure)
 		}
+	}
 
-		fmt.Print("\n----OUT OF ORDER----\n")
-		err = proxy.CheckReferrersOutOfOrder(ctx.Int(referrersCountStr), version)
-		if err != nil {
-			fmt.Print(err)
+	if ctx.Bool(consistencyStr) {
+		opts := registry.ConsistencyOptions{
+			Iterations: ctx.Int(iterationsStr),
+			Interval:   ctx.Duration(intervalStr),
+			Timeout:    ctx.Duration(timeoutStr),
 		}
+		forEachVersion(func(proxy registry.Proxy, version string) {
+			fmt.Print("----CONSISTENCY----\n")
+			check(proxy.CheckReferrersConsistency(opts, version))
+		})
+		return failure
+	}
 
+	if ctx.Bool(paginationStr) {
+		opts := registry.PaginationOptions{
+			Referrers:   ctx.Int(referrersCountStr),
+			Concurrency: ctx.Int(concurrencyStr),
+		}
+		forEachVersion(func(proxy registry.Proxy, version string) {
+			fmt.Print("----PAGINATION----\n")
+			check(proxy.CheckReferrersPagination(opts, version))
+		})
+		return failure
 	}
 
-	return nil
+	forEachVersion(func(proxy registry.Proxy, version string) {
+		fmt.Print("----ORDERED----\n")
+
+		check(proxy.CheckReferrers(ctx.Int(referrersCountStr), version))
+
+		fmt.Print("\n----OUT OF ORDER----\n")
+		check(proxy.CheckReferrersOutOfOrder(ctx.Int(referrersCountStr), version))
+
+		fmt.Print("\n----ARTIFACT TYPE FILTER----\n")
+		check(proxy.CheckReferrersFilter(version))
+
+		fmt.Print("\n----INDEX, UNTAGGED AND CHAINED SUBJECTS----\n")
+		check(proxy.CheckReferrersGraph(version))
+
+		fmt.Print("\n----DELETION----\n")
+		check(proxy.CheckReferrersDeletion(version))
+
+		fmt.Print("\n----TAG SCHEMA FALLBACK----\n")
+		check(proxy.CheckReferrersFallback(ctx.Int(referrersCountStr), version))
+	})
+
+	return failure
+}
+
+// printError prints the error of a failed check with its category, and records the request that caused it.
+func printError(err error) {
+	fmt.Printf("[%v] %v", registry.Classify(err), err)
+	recordFailure(err)
 }
@@ -0,0 +1,428 @@
+package har
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+)
+
+// Version is the HAR version written by Recorder.
+const Version = "1.2"
+
+// redacted replaces secrets.
+const redacted = "REDACTED"
+
+// secretFields are JSON fields of response bodies that hold secrets, such as those of token responses.
+var secretFields = []string{"access_token", "refresh_token", "token"}
+
+// realmRegex matches the realm of an authentication challenge, such as that of the Www-Authenticate header.
+var realmRegex = regexp.MustCompile(`realm="([^"]*)"`)
+
+// HTTP Archive 1.2 format.
+// See: http://www.softwareishard.com/blog/har-12-spec/
+type (
+	// HAR is the root of an HTTP archive.
+	HAR struct {
+		Log Log `json:"log"`
+	}
+
+	// Log holds the archived round trips.
+	Log struct {
+		Version string  `json:"version"`
+		Creator Creator `json:"creator"`
+		Entries []Entry `json:"entries"`
+	}
+
+	// Creator describes the application that created the archive.
+	Creator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	// Entry is a round trip.
+	Entry struct {
+		StartedDateTime time.Time `json:"startedDateTime"`
+		Time            float64   `json:"time"`
+		Request         Request   `json:"request"`
+		Response        Response  `json:"response"`
+		Cache           struct{}  `json:"cache"`
+		Timings         Timings   `json:"timings"`
+		ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+		Comment         string    `json:"comment,omitempty"`
+	}
+
+	// Request is the request of a round trip.
+	Request struct {
+		Method      string      `json:"method"`
+		URL         string      `json:"url"`
+		HTTPVersion string      `json:"httpVersion"`
+		Cookies     []NameValue `json:"cookies"`
+		Headers     []NameValue `json:"headers"`
+		QueryString []NameValue `json:"queryString"`
+		HeadersSize int64       `json:"headersSize"`
+		BodySize    int64       `json:"bodySize"`
+	}
+
+	// Response is the response of a round trip.
+	Response struct {
+		Status      int         `json:"status"`
+		StatusText  string      `json:"statusText"`
+		HTTPVersion string      `json:"httpVersion"`
+		Cookies     []NameValue `json:"cookies"`
+		Headers     []NameValue `json:"headers"`
+		Content     Content     `json:"content"`
+		RedirectURL string      `json:"redirectURL"`
+		HeadersSize int64       `json:"headersSize"`
+		BodySize    int64       `json:"bodySize"`
+	}
+
+	// Content is the body of a response.
+	Content struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Comment  string `json:"comment,omitempty"`
+	}
+
+	// NameValue is a header, cookie or query parameter.
+	NameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	// Timings are the phases of a round trip in milliseconds. Phases that do not apply are -1.
+	Timings struct {
+		Blocked float64 `json:"blocked"`
+		DNS     float64 `json:"dns"`
+		Connect float64 `json:"connect"`
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+		SSL     float64 `json:"ssl"`
+	}
+)
+
+// Recorder records round trips as HAR entries. Secrets are redacted, and only textual response bodies are
+// kept.
+type Recorder struct {
+	// Limit, if positive, is the maximum number of entries kept. The oldest entries are dropped first, so
+	// that long-lived processes only keep their most recent traffic.
+	Limit int
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Observe records a round trip. It can be used with rhttp.Observe.
+func (r *Recorder) Observe(info rhttp.RoundTripInfo, err error) {
+	entry := newEntry(info, err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+	if r.Limit > 0 && len(r.entries) > r.Limit {
+		r.entries = r.entries[len(r.entries)-r.Limit:]
+	}
+}
+
+// Write writes the recorded round trips, in the order they started, as an HTTP archive created by the
+// named application.
+func (r *Recorder) Write(w io.Writer, name, version string) error {
+	r.mu.Lock()
+	entries := append([]Entry(nil), r.entries...)
+	r.mu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: name, Version: version},
+			Entries: entries,
+		},
+	})
+}
+
+// WriteFile writes the archive to path like Write. The file is replaced atomically.
+func (r *Recorder) WriteFile(path, name, version string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := r.Write(tmp, name, version); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Temp files are only readable by the owner.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// newEntry returns the HAR entry of a round trip.
+func newEntry(info rhttp.RoundTripInfo, err error) Entry {
+	timings := newTimings(info.Timings)
+
+	entry := Entry{
+		StartedDateTime: info.Request.StartedAt,
+		Time:            timings.total(),
+		Request: Request{
+			Method:      info.Request.Method,
+			URL:         redactURL(info.Request.URL),
+			HTTPVersion: info.Response.Proto,
+			Cookies:     []NameValue{},
+			Headers:     headers(info.Request.Header),
+			QueryString: queryString(info.Request.URL),
+			HeadersSize: -1,
+			BodySize:    info.Request.Size,
+		},
+		Response: Response{
+			Status:      info.Response.Code,
+			StatusText:  http.StatusText(info.Response.Code),
+			HTTPVersion: info.Response.Proto,
+			Cookies:     []NameValue{},
+			Headers:     headers(info.Response.Header),
+			Content:     content(info.Response),
+			RedirectURL: redactURL(info.Response.HeaderLocation),
+			HeadersSize: -1,
+			BodySize:    info.Response.Size,
+		},
+		Timings: timings,
+	}
+
+	if host, _, splitErr := net.SplitHostPort(info.Response.RemoteAddr); splitErr == nil {
+		entry.ServerIPAddress = host
+	}
+	if err != nil {
+		entry.Comment = err.Error()
+	}
+
+	return entry
+}
+
+// newTimings converts the timings of a round trip.
+func newTimings(t rhttp.Timings) Timings {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	optional := func(d time.Duration) float64 {
+		if d == 0 {
+			return -1
+		}
+		return ms(d)
+	}
+
+	return Timings{
+		Blocked: optional(t.Blocked),
+		DNS:     optional(t.DNS),
+		// The connect time includes the TLS handshake.
+		Connect: optional(t.Connect + t.TLS),
+		Send:    ms(t.Send),
+		Wait:    ms(t.Wait),
+		Receive: ms(t.Receive),
+		SSL:     optional(t.TLS),
+	}
+}
+
+// total returns the total time of the round trip, which excludes SSL as it is part of connect.
+func (t Timings) total() float64 {
+	total := t.Send + t.Wait + t.Receive
+	for _, phase := range []float64{t.Blocked, t.DNS, t.Connect} {
+		if phase > 0 {
+			total += phase
+		}
+	}
+	return total
+}
+
+// headers returns the headers sorted by name, with credentials, cookies and SAS tokens redacted.
+func headers(header http.Header) []NameValue {
+	pairs := []NameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			switch http.CanonicalHeaderKey(name) {
+			case rhttp.HeaderAuthorization:
+				// Keep the scheme, such as Basic or Bearer.
+				scheme := strings.SplitN(value, " ", 2)[0]
+				value = scheme + " " + redacted
+			case "Location":
+				if u, err := url.Parse(value); err == nil {
+					value = redactURL(u)
+				}
+			case "Cookie":
+				// Keep the cookie names.
+				cookies := strings.Split(value, ";")
+				for i, cookie := range cookies {
+					cookies[i] = redactCookie(cookie)
+				}
+				value = strings.Join(cookies, ";")
+			case "Set-Cookie":
+				// Keep the cookie name and attributes.
+				parts := strings.SplitN(value, ";", 2)
+				parts[0] = redactCookie(parts[0])
+				value = strings.Join(parts, ";")
+			case "Www-Authenticate":
+				value = realmRegex.ReplaceAllStringFunc(value, redactRealm)
+			}
+			pairs = append(pairs, NameValue{Name: name, Value: value})
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+	return pairs
+}
+
+// redactCookie redacts the value of a name=value cookie pair.
+func redactCookie(pair string) string {
+	return strings.SplitN(pair, "=", 2)[0] + "=" + redacted
+}
+
+// redactRealm redacts the query parameters of the realm of an authentication challenge, which may carry
+// tokens.
+func redactRealm(challenge string) string {
+	u, err := url.Parse(realmRegex.FindStringSubmatch(challenge)[1])
+	if err != nil || u.RawQuery == "" {
+		return challenge
+	}
+
+	query := u.Query()
+	for name := range query {
+		query.Set(name, redacted)
+	}
+	u.RawQuery = query.Encode()
+	return `realm="` + u.String() + `"`
+}
+
+// queryString returns the query parameters of u, with SAS tokens redacted.
+func queryString(u *url.URL) []NameValue {
+	pairs := []NameValue{}
+	if u == nil {
+		return pairs
+	}
+
+	query := redactQuery(u.Query())
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, NameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// redactURL returns u as a string with the signature of SAS tokens redacted.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redactedURL := *u
+	if query := u.Query(); query.Get("sig") != "" {
+		redactedURL.RawQuery = redactQuery(query).Encode()
+	}
+	return redactedURL.String()
+}
+
+// redactQuery redacts the signature of SAS tokens.
+func redactQuery(query url.Values) url.Values {
+	if query.Get("sig") != "" {
+		query.Set("sig", redacted)
+	}
+	return query
+}
+
+// content returns the content of a response. Bodies are only kept if they are textual, such as JSON
+// manifests and error bodies, with secrets of token responses redacted.
+func content(resp rhttp.Response) Content {
+	c := Content{
+		Size:     resp.Size,
+		MimeType: resp.HeaderContentType,
+	}
+	if len(resp.Body) == 0 {
+		return c
+	}
+
+	if !isText(resp.HeaderContentType) {
+		c.Comment = "body of non-textual content omitted"
+		return c
+	}
+
+	c.Text = string(redactBody(resp.Body))
+	return c
+}
+
+// isText reports whether the media type is textual.
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// redactBody redacts the secrets of JSON bodies.
+func redactBody(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+
+	var found bool
+	for _, name := range secretFields {
+		if _, ok := fields[name]; ok {
+			fields[name] = json.RawMessage(`"` + redacted + `"`)
+			found = true
+		}
+	}
+	if !found {
+		return body
+	}
+
+	redactedBody, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return redactedBody
+}
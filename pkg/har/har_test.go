@@ -0,0 +1,115 @@
+package har
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   []NameValue
+	}{
+		{
+			name:   "none",
+			header: nil,
+			want:   []NameValue{},
+		},
+		{
+			name:   "sorted",
+			header: http.Header{"Content-Type": {"application/json"}, "Accept": {"a", "b"}},
+			want:   []NameValue{{"Accept", "a"}, {"Accept", "b"}, {"Content-Type", "application/json"}},
+		},
+		{
+			name:   "authorization",
+			header: http.Header{"Authorization": {"Bearer abc.def.ghi"}},
+			want:   []NameValue{{"Authorization", "Bearer REDACTED"}},
+		},
+		{
+			name:   "location",
+			header: http.Header{"Location": {"https://r.blob.core.windows.net/c/b?sv=2019&sig=abc"}},
+			want:   []NameValue{{"Location", "https://r.blob.core.windows.net/c/b?sig=REDACTED&sv=2019"}},
+		},
+		{
+			name:   "cookie",
+			header: http.Header{"Cookie": {"session=abc; theme=dark"}},
+			want:   []NameValue{{"Cookie", "session=REDACTED; theme=REDACTED"}},
+		},
+		{
+			name:   "set cookie",
+			header: http.Header{"Set-Cookie": {"session=abc; Path=/; HttpOnly"}},
+			want:   []NameValue{{"Set-Cookie", "session=REDACTED; Path=/; HttpOnly"}},
+		},
+		{
+			name:   "www-authenticate",
+			header: http.Header{"Www-Authenticate": {`Bearer realm="https://r.azurecr.io/oauth2/token?token=abc",service="r.azurecr.io"`}},
+			want:   []NameValue{{"Www-Authenticate", `Bearer realm="https://r.azurecr.io/oauth2/token?token=REDACTED",service="r.azurecr.io"`}},
+		},
+		{
+			name:   "www-authenticate without query",
+			header: http.Header{"Www-Authenticate": {`Bearer realm="https://r.azurecr.io/oauth2/token",service="r.azurecr.io"`}},
+			want:   []NameValue{{"Www-Authenticate", `Bearer realm="https://r.azurecr.io/oauth2/token",service="r.azurecr.io"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := headers(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("headers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://r.azurecr.io/v2/a/blobs/sha256:abc", "https://r.azurecr.io/v2/a/blobs/sha256:abc"},
+		{"https://r.azurecr.io/v2/a/tags/list?n=10", "https://r.azurecr.io/v2/a/tags/list?n=10"},
+		{"https://r.blob.core.windows.net/c/b?sv=2019&sig=abc", "https://r.blob.core.windows.net/c/b?sig=REDACTED&sv=2019"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := redactURL(u); got != tt.want {
+				t.Errorf("redactURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := redactURL(nil); got != "" {
+		t.Errorf("redactURL(nil) = %v, want an empty string", got)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"not json", "not json", "not json"},
+		{"json array", `[{"token":"abc"}]`, `[{"token":"abc"}]`},
+		{"no secrets", `{"schemaVersion":2}`, `{"schemaVersion":2}`},
+		{"access token", `{"access_token":"abc"}`, `{"access_token":"REDACTED"}`},
+		{"refresh token", `{"refresh_token":"abc","expires_in":300}`, `{"expires_in":300,"refresh_token":"REDACTED"}`},
+		{"token", `{"token":"abc","access_token":"def"}`, `{"access_token":"REDACTED","token":"REDACTED"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(redactBody([]byte(tt.body))); got != tt.want {
+				t.Errorf("redactBody() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package http
+
+import (
+	"net/http"
+)
+
+// ObservedRoundTripper calls Observe with the info of every round trip made by Base, including failed ones.
+type ObservedRoundTripper struct {
+	Base    RoundTripper
+	Observe func(RoundTripInfo, error)
+}
+
+// RoundTrip makes the round trip with Base and observes it.
+func (o ObservedRoundTripper) RoundTrip(req *http.Request) (RoundTripInfo, error) {
+	info, err := o.Base.RoundTrip(req)
+	o.Observe(info, err)
+	return info, err
+}
+
+// Observe returns tripper, calling observe with the info of every round trip it makes.
+func Observe(tripper RoundTripper, observe func(RoundTripInfo, error)) RoundTripper {
+	return ObservedRoundTripper{Base: tripper, Observe: observe}
+}
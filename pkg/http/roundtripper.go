@@ -1,15 +1,18 @@
 package http
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
 	"github.com/opencontainers/go-digest"
 	"github.com/rs/zerolog"
 )
@@ -21,6 +24,16 @@ const (
 	HeaderContentType   = "Content-Type"
 	HeaderAccept        = "Accept"
 	HeaderLink          = "Link"
+	HeaderFilters       = "OCI-Filters-Applied"
+	HeaderSubject       = "OCI-Subject"
+	HeaderTraceparent   = "traceparent"
+	HeaderContentRange  = "Content-Range"
+	HeaderRange         = "Range"
+
+	// Headers identifying a request to the registry operator.
+	HeaderCorrelationRequestID = "X-Ms-Correlation-Request-Id"
+	HeaderRequestID            = "X-Ms-Request-Id"
+	HeaderAPIVersion           = "Docker-Distribution-Api-Version"
 )
 
 // Request represents a request made to the registry.
@@ -29,24 +42,41 @@ type Request struct {
 	URL                 *url.URL  `json:"url"`
 	HeaderAuthorization string    `json:"authorization"`
 	StartedAt           time.Time `json:"startedAt"`
+	Size                int64     `json:"size,omitempty"`
+
+	// Header holds all headers of the request, including secrets.
+	Header http.Header `json:"-"`
 }
 
 // Response respresents a response received from the registry.
 type Response struct {
-	Code            int             `json:"code,omitempty"`
-	HeaderChallenge string          `json:"Www-Authenticate,omitempty"`
-	HeaderLocation  *url.URL        `json:"redirectLocation,omitempty"`
-	HeaderLink      string          `json:"link,omitempty"`
-	Size            int64           `json:"size,omitempty"`
-	SHA256Sum       digest.Digest   `json:"sha256,omitempty"`
-	Body            json.RawMessage `json:"body,omitempty"`
+	Code                       int             `json:"code,omitempty"`
+	HeaderChallenge            string          `json:"Www-Authenticate,omitempty"`
+	HeaderLocation             *url.URL        `json:"redirectLocation,omitempty"`
+	HeaderLink                 string          `json:"link,omitempty"`
+	HeaderContentType          string          `json:"contentType,omitempty"`
+	HeaderFilters              string          `json:"ociFiltersApplied,omitempty"`
+	HeaderSubject              string          `json:"ociSubject,omitempty"`
+	HeaderCorrelationRequestID string          `json:"correlationRequestId,omitempty"`
+	HeaderRequestID            string          `json:"requestId,omitempty"`
+	HeaderAPIVersion           string          `json:"dockerDistributionApiVersion,omitempty"`
+	Size                       int64           `json:"size,omitempty"`
+	SHA256Sum                  digest.Digest   `json:"sha256,omitempty"`
+	Body                       json.RawMessage `json:"body,omitempty"`
+	RemoteAddr                 string          `json:"remoteAddr,omitempty"`
+
+	// Proto, Header and TLS are the protocol, all headers and the TLS connection state of the response.
+	Proto  string               `json:"-"`
+	Header http.Header          `json:"-"`
+	TLS    *tls.ConnectionState `json:"-"`
 }
 
 // RoundTripInfo represents information about a network round-trip.
 type RoundTripInfo struct {
 	Request  `json:"request"`
 	Response `json:"response"`
-	Elapsed  string `json:"elapsed"`
+	Elapsed  string  `json:"elapsed"`
+	Timings  Timings `json:"-"`
 }
 
 // RoundTripper provides a means to do an HTTP/HTTPs round trip.
@@ -62,65 +92,121 @@ type RoundTripperWithContext struct {
 }
 
 // RoundTrip does an HTTP/HTTPs roundtrip and returns the response with some contextual info.
+// If the request context carries a span, the round trip is traced as its child.
 func (r RoundTripperWithContext) RoundTrip(req *http.Request) (RoundTripInfo, error) {
+	span := tracing.SpanFromContext(req.Context()).Child("HTTP "+req.Method, tracing.SpanKindClient)
+	if span != nil {
+		req.Header.Set(HeaderTraceparent, span.Traceparent())
+	}
+
 	info := RoundTripInfo{
 		Request: Request{
 			Method:              req.Method,
 			URL:                 req.URL,
 			StartedAt:           time.Now(),
 			HeaderAuthorization: req.Header.Get(HeaderAuthorization),
+			Header:              req.Header,
 		},
 	}
-	defer func() {
-		info.Elapsed = time.Since(info.StartedAt).String()
-		var msg string
-		bytes, err := json.MarshalIndent(info, "", "   ")
-
-		if err != nil && strings.HasPrefix(err.Error(), "json: error calling MarshalJSON for type") {
-			// Hack: This could be due to a non-JSON response. Attempt to modify the response body to JSON.
-			original := info.Response.Body
-			info.Response.Body = json.RawMessage(fmt.Sprintf("{\"pretty\": \"%s\"}", url.PathEscape(string(original))))
-			bytes, err = json.MarshalIndent(info, "", "   ")
-			info.Response.Body = original
-		}
 
-		if err != nil {
-			msg = fmt.Sprintf("marshal_error: %v", err)
-		} else {
-			msg = string(bytes)
-		}
-		r.Logger.Trace().Msg(msg)
-	}()
+	// Time the phases of the round trip.
+	timer := newTimer(info.StartedAt)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+
+	var body io.Reader
+	if req.Body != nil {
+		body = io.NewReader(req.Body)
+		req.Body = countedBody{Reader: body, closer: req.Body}
+	}
+
+	err := r.roundTrip(req, &info)
+
+	// Complete the info whether or not the round trip failed, so that callers get its timings.
+	info.Elapsed = time.Since(info.StartedAt).String()
+	info.Timings = timer.timings(time.Now())
+	info.Response.RemoteAddr = timer.remoteAddress()
+	if body != nil {
+		info.Request.Size = body.N()
+	}
+
+	r.log(info)
+	traceRoundTrip(span, info, err)
+
+	return info, err
+}
 
+// roundTrip sends req and records the response in info.
+func (r RoundTripperWithContext) roundTrip(req *http.Request, info *RoundTripInfo) error {
 	resp, err := r.Base.RoundTrip(req)
 	if err != nil {
-		return info, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	bodyReader := io.NewReader(resp.Body)
 	bodyBytes, err := ioutil.ReadAll(bodyReader)
 	if err != nil {
-		return info, err
+		return err
 	}
 
 	info.Response = Response{
-		Code:            resp.StatusCode,
-		HeaderChallenge: resp.Header.Get(HeaderChallenge),
-		HeaderLink:      resp.Header.Get(HeaderLink),
-		Size:            bodyReader.N(),
-		SHA256Sum:       digest.NewDigest(digest.SHA256, bodyReader.SHA256Hash()),
-		Body:            bodyBytes,
+		Code:                       resp.StatusCode,
+		HeaderChallenge:            resp.Header.Get(HeaderChallenge),
+		HeaderLink:                 resp.Header.Get(HeaderLink),
+		HeaderContentType:          resp.Header.Get(HeaderContentType),
+		HeaderFilters:              resp.Header.Get(HeaderFilters),
+		HeaderSubject:              resp.Header.Get(HeaderSubject),
+		HeaderCorrelationRequestID: resp.Header.Get(HeaderCorrelationRequestID),
+		HeaderRequestID:            resp.Header.Get(HeaderRequestID),
+		HeaderAPIVersion:           resp.Header.Get(HeaderAPIVersion),
+		Size:                       bodyReader.N(),
+		SHA256Sum:                  digest.NewDigest(digest.SHA256, bodyReader.SHA256Hash()),
+		Body:                       bodyBytes,
+		Proto:                      resp.Proto,
+		Header:                     resp.Header,
+		TLS:                        resp.TLS,
 	}
 
 	locURL, err := resp.Location()
 	if err != nil {
 		if err != http.ErrNoLocation {
-			return info, err
+			return err
 		}
 	} else {
 		info.Response.HeaderLocation = locURL
 	}
 
-	return info, nil
+	return nil
+}
+
+// log logs the round trip at trace level.
+func (r RoundTripperWithContext) log(info RoundTripInfo) {
+	var msg string
+	bytes, err := json.MarshalIndent(info, "", "   ")
+
+	if err != nil && strings.HasPrefix(err.Error(), "json: error calling MarshalJSON for type") {
+		// Hack: This could be due to a non-JSON response. Attempt to modify the response body to JSON.
+		original := info.Response.Body
+		info.Response.Body = json.RawMessage(fmt.Sprintf("{\"pretty\": \"%s\"}", url.PathEscape(string(original))))
+		bytes, err = json.MarshalIndent(info, "", "   ")
+		info.Response.Body = original
+	}
+
+	if err != nil {
+		msg = fmt.Sprintf("marshal_error: %v", err)
+	} else {
+		msg = string(bytes)
+	}
+	r.Logger.Trace().Msg(msg)
+}
+
+// countedBody counts the bytes of a request body as they are sent.
+type countedBody struct {
+	io.Reader
+	closer interface{ Close() error }
+}
+
+// Close closes the underlying body.
+func (b countedBody) Close() error {
+	return b.closer.Close()
 }
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings are the phases of a round trip. Phases that did not happen, such as DNS lookups and connecting
+// when a connection is reused, are zero.
+type Timings struct {
+	// Blocked is the time spent waiting for a connection, other than DNS, Connect and TLS.
+	Blocked time.Duration
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	Send    time.Duration
+	Wait    time.Duration
+	Receive time.Duration
+}
+
+// timer records the times of the phases of a round trip with an httptrace.ClientTrace.
+type timer struct {
+	mu                               sync.Mutex
+	start, dnsStart, dnsDone         time.Time
+	connectStart, connectDone        time.Time
+	tlsStart, tlsDone                time.Time
+	gotConn, wroteRequest, firstByte time.Time
+	remoteAddr                       string
+}
+
+// newTimer returns a timer of a round trip starting at start.
+func newTimer(start time.Time) *timer {
+	return &timer{start: start}
+}
+
+// trace returns the client trace recording the times. Only the first occurrence of each event is recorded,
+// such as the first of parallel dials.
+func (t *timer) trace() *httptrace.ClientTrace {
+	record := func(at *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if at.IsZero() {
+			*at = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { record(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { record(&t.dnsDone) },
+		ConnectStart:      func(string, string) { record(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { record(&t.connectDone) },
+		TLSHandshakeStart: func() { record(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { record(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(&t.gotConn)
+
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { record(&t.wroteRequest) },
+		GotFirstResponseByte: func() { record(&t.firstByte) },
+	}
+}
+
+// timings returns the phases of a round trip that ended at end.
+func (t *timer) timings(end time.Time) Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	between := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return to.Sub(from)
+	}
+
+	timings := Timings{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.connectDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		Send:    between(t.gotConn, t.wroteRequest),
+		Wait:    between(t.wroteRequest, t.firstByte),
+		Receive: between(t.firstByte, end),
+	}
+	if blocked := between(t.start, t.gotConn) - timings.DNS - timings.Connect - timings.TLS; blocked > 0 {
+		timings.Blocked = blocked
+	}
+	return timings
+}
+
+// remoteAddress returns the address of the connection of the round trip, if any.
+func (t *timer) remoteAddress() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remoteAddr
+}
@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
+)
+
+// RedactURL returns u as a string without the query of shared access signatures, so that SAS tokens of
+// data endpoint URLs do not leak.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	if redacted.Query().Get("sig") != "" {
+		redacted.RawQuery = ""
+	}
+	return redacted.String()
+}
+
+// traceRoundTrip sets the attributes of a round trip span and ends it. Responses with 4xx and 5xx codes
+// mark the span as failed, as for OpenTelemetry HTTP client spans.
+func traceRoundTrip(span *tracing.Span, info RoundTripInfo, err error) {
+	if span == nil {
+		return
+	}
+
+	span.SetAttribute("http.method", info.Request.Method)
+	if u := info.Request.URL; u != nil {
+		span.SetAttribute("http.url", RedactURL(u))
+		span.SetAttribute("net.peer.name", u.Hostname())
+	}
+	if info.Request.Size > 0 {
+		span.SetAttribute("http.request_content_length", info.Request.Size)
+	}
+
+	if code := info.Response.Code; code != 0 {
+		span.SetAttribute("http.status_code", code)
+		span.SetAttribute("http.response_content_length", info.Response.Size)
+		if code >= http.StatusBadRequest && err == nil {
+			span.SetError(http.StatusText(code))
+		}
+	}
+
+	span.End(err)
+}
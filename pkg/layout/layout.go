@@ -0,0 +1,448 @@
+package layout
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Names of files in an OCI image layout and a docker save tarball.
+const (
+	fileOCILayout      = ociimagespec.ImageLayoutFile
+	fileIndex          = "index.json"
+	fileDockerManifest = "manifest.json"
+	dirBlobs           = "blobs"
+)
+
+// dockerManifest is an entry of the manifest.json file of a docker save tarball.
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// Image is an image read from an OCI image layout or a docker save tarball.
+type Image struct {
+	// Root describes the image manifest or index of the image.
+	Root ociimagespec.Descriptor
+
+	// files is where the image content is stored.
+	files fileSystem
+
+	// paths maps digests to file names for content not stored under blobs/.
+	paths map[digest.Digest]string
+
+	// generated holds content that is not stored on disk, such as manifests created for docker save tarballs.
+	generated map[digest.Digest][]byte
+}
+
+// Open reads the image at path, which may be an OCI image layout directory or tarball, or a docker save
+// tarball or its extracted directory. If the source holds more than one image, name selects the image by
+// its org.opencontainers.image.ref.name annotation or docker repository tag.
+func Open(path, name string) (*Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files fileSystem
+	if info.IsDir() {
+		files = dirFS(path)
+	} else {
+		files, err = newTarFS(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	image := &Image{
+		files:     files,
+		paths:     make(map[digest.Digest]string),
+		generated: make(map[digest.Digest][]byte),
+	}
+
+	switch {
+	case files.exists(fileOCILayout):
+		err = image.loadOCILayout(name)
+	case files.exists(fileDockerManifest):
+		err = image.loadDockerSave(name)
+	default:
+		err = fmt.Errorf("%v is neither an OCI image layout nor a docker save tarball", path)
+	}
+
+	if err != nil {
+		files.close()
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// Blob opens the content with the given digest.
+func (i *Image) Blob(dgst digest.Digest) (io.ReadCloser, error) {
+	if data, ok := i.generated[dgst]; ok {
+		return ioutil.NopCloser(strings.NewReader(string(data))), nil
+	}
+
+	if name, ok := i.paths[dgst]; ok {
+		return i.files.open(name)
+	}
+
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	return i.files.open(path.Join(dirBlobs, dgst.Algorithm().String(), dgst.Hex()))
+}
+
+// ReadBlob reads the content with the given digest.
+func (i *Image) ReadBlob(dgst digest.Digest) ([]byte, error) {
+	rc, err := i.Blob(dgst)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+// Close releases the resources held by the image.
+func (i *Image) Close() error {
+	return i.files.close()
+}
+
+// loadOCILayout selects the root of the image from the index.json of an OCI image layout.
+func (i *Image) loadOCILayout(name string) error {
+	layoutBytes, err := i.files.readFile(fileOCILayout)
+	if err != nil {
+		return err
+	}
+
+	var layout ociimagespec.ImageLayout
+	if err = json.Unmarshal(layoutBytes, &layout); err != nil {
+		return err
+	}
+	if layout.Version != ociimagespec.ImageLayoutVersion {
+		return fmt.Errorf("unsupported image layout version: %v", layout.Version)
+	}
+
+	indexBytes, err := i.files.readFile(fileIndex)
+	if err != nil {
+		return err
+	}
+
+	var index ociimagespec.Index
+	if err = json.Unmarshal(indexBytes, &index); err != nil {
+		return err
+	}
+
+	var names []string
+	for _, desc := range index.Manifests {
+		refName := desc.Annotations[ociimagespec.AnnotationRefName]
+		if name == "" && len(index.Manifests) == 1 || name != "" && refName == name {
+			i.Root = desc
+			return nil
+		}
+		names = append(names, refName)
+	}
+
+	if name == "" {
+		return fmt.Errorf("image layout holds %v images, select one of: %v", len(index.Manifests), strings.Join(names, ", "))
+	}
+	return fmt.Errorf("image %v not found in image layout", name)
+}
+
+// loadDockerSave creates an OCI image manifest for an image in the manifest.json of a docker save tarball.
+func (i *Image) loadDockerSave(name string) error {
+	manifestBytes, err := i.files.readFile(fileDockerManifest)
+	if err != nil {
+		return err
+	}
+
+	var manifests []dockerManifest
+	if err = json.Unmarshal(manifestBytes, &manifests); err != nil {
+		return err
+	}
+
+	var (
+		selected *dockerManifest
+		names    []string
+	)
+	for idx, m := range manifests {
+		if name == "" && len(manifests) == 1 {
+			selected = &manifests[idx]
+			break
+		}
+		for _, repoTag := range m.RepoTags {
+			if repoTag == name || repoTag == name+":latest" {
+				selected = &manifests[idx]
+			}
+		}
+		names = append(names, m.RepoTags...)
+	}
+
+	if selected == nil {
+		if name == "" {
+			return fmt.Errorf("docker save tarball holds %v images, select one of: %v", len(manifests), strings.Join(names, ", "))
+		}
+		return fmt.Errorf("image %v not found in docker save tarball", name)
+	}
+
+	manifest := ociimagespec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageManifest,
+	}
+
+	manifest.Config, err = i.addFile(selected.Config, ociimagespec.MediaTypeImageConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, layer := range selected.Layers {
+		desc, err := i.addFile(layer, ociimagespec.MediaTypeImageLayer)
+		if err != nil {
+			return err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	rootBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	i.Root = ociimagespec.Descriptor{
+		MediaType: ociimagespec.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(rootBytes),
+		Size:      int64(len(rootBytes)),
+	}
+	i.generated[i.Root.Digest] = rootBytes
+
+	return nil
+}
+
+// addFile digests the named file and makes it available by digest.
+func (i *Image) addFile(name, mediaType string) (ociimagespec.Descriptor, error) {
+	rc, err := i.files.open(name)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+	defer rc.Close()
+
+	digester := digest.SHA256.Digester()
+	size, err := io.Copy(digester.Hash(), rc)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	desc := ociimagespec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digester.Digest(),
+		Size:      size,
+	}
+	i.paths[desc.Digest] = name
+
+	return desc, nil
+}
+
+// fileSystem provides read access to the files of an image on disk.
+type fileSystem interface {
+	// open opens the named file. Names use forward slashes.
+	open(name string) (io.ReadCloser, error)
+
+	// exists reports whether the named file exists.
+	exists(name string) bool
+
+	// readFile reads the named file.
+	readFile(name string) ([]byte, error)
+
+	// close releases the resources held by the file system.
+	close() error
+}
+
+// dirFS is a fileSystem backed by a directory.
+type dirFS string
+
+func (d dirFS) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirFS) exists(name string) bool {
+	_, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(name)))
+	return err == nil
+}
+
+func (d dirFS) readFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirFS) close() error {
+	return nil
+}
+
+// tarEntry is the location of a regular file in a tarball.
+type tarEntry struct {
+	offset int64
+	size   int64
+}
+
+// tarFS is a fileSystem backed by a tarball. Gzip compressed tarballs are decompressed to a temporary
+// file so that entries can be read in any order.
+type tarFS struct {
+	file    *os.File
+	temp    bool
+	entries map[string]tarEntry
+}
+
+// newTarFS indexes the regular files of the tarball at path.
+func newTarFS(path string) (*tarFS, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tarFS{file: file, entries: make(map[string]tarEntry)}
+
+	compressed, err := isGzip(file)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	if compressed {
+		if err = t.decompress(); err != nil {
+			t.close()
+			return nil, err
+		}
+	}
+
+	if err = t.index(); err != nil {
+		t.close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// isGzip reports whether file starts with the gzip magic number, and rewinds it.
+func isGzip(file *os.File) (bool, error) {
+	magic := make([]byte, 2)
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return n == 2 && magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+// decompress replaces the tarball with a decompressed temporary copy.
+func (t *tarFS) decompress() error {
+	gr, err := gzip.NewReader(bufio.NewReader(t.file))
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	temp, err := ioutil.TempFile("", "acr-image-*.tar")
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(temp, gr); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+
+	t.file.Close()
+	t.file, t.temp = temp, true
+
+	return nil
+}
+
+// index records the offset and size of each regular file in the tarball.
+func (t *tarFS) index() error {
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	counter := &countingReader{r: t.file}
+	tr := tar.NewReader(counter)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		t.entries[path.Clean(header.Name)] = tarEntry{offset: counter.n, size: header.Size}
+	}
+
+	if len(t.entries) == 0 {
+		return errors.New("tarball has no files")
+	}
+
+	return nil
+}
+
+func (t *tarFS) open(name string) (io.ReadCloser, error) {
+	entry, ok := t.entries[path.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return ioutil.NopCloser(io.NewSectionReader(t.file, entry.offset, entry.size)), nil
+}
+
+func (t *tarFS) exists(name string) bool {
+	_, ok := t.entries[path.Clean(name)]
+	return ok
+}
+
+func (t *tarFS) readFile(name string) ([]byte, error) {
+	rc, err := t.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+func (t *tarFS) close() error {
+	err := t.file.Close()
+	if t.temp {
+		os.Remove(t.file.Name())
+	}
+	return err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
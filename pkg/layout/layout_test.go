@@ -0,0 +1,249 @@
+package layout
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestOpenOCILayout(t *testing.T) {
+	dir := t.TempDir()
+	layoutDir := filepath.Join(dir, "layout")
+
+	w, err := NewWriter(layoutDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := writeImage(t, w, "v1", "layer one")
+	v2 := writeImage(t, w, "v2", "layer two")
+
+	plainTar := filepath.Join(dir, "layout.tar")
+	gzipTar := filepath.Join(dir, "layout.tar.gz")
+	tarDir(t, layoutDir, plainTar, false)
+	tarDir(t, layoutDir, gzipTar, true)
+
+	for _, path := range []string{layoutDir, plainTar, gzipTar} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			for name, want := range map[string]ociimagespec.Descriptor{"v1": v1, "v2": v2} {
+				image, err := Open(path, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if image.Root.Digest != want.Digest {
+					t.Errorf("root of %v = %v, want %v", name, image.Root.Digest, want.Digest)
+				}
+				verifyImage(t, image)
+				image.Close()
+			}
+
+			if _, err := Open(path, ""); err == nil {
+				t.Error("Open() without a name of a layout of 2 images succeeded")
+			}
+			if _, err := Open(path, "v3"); err == nil {
+				t.Error("Open() of a missing image succeeded")
+			}
+		})
+	}
+}
+
+func TestOpenDockerSave(t *testing.T) {
+	dir := t.TempDir()
+	saveDir := filepath.Join(dir, "save")
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer")
+	writeFile(t, saveDir, "abc.json", config)
+	writeFile(t, saveDir, "abc/layer.tar", layer)
+
+	manifests, err := json.Marshal([]dockerManifest{{
+		Config:   "abc.json",
+		RepoTags: []string{"hello:latest"},
+		Layers:   []string{"abc/layer.tar"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, saveDir, fileDockerManifest, manifests)
+
+	saveTar := filepath.Join(dir, "save.tar")
+	tarDir(t, saveDir, saveTar, false)
+
+	for _, path := range []string{saveDir, saveTar} {
+		for _, name := range []string{"", "hello", "hello:latest"} {
+			t.Run(filepath.Base(path)+" "+name, func(t *testing.T) {
+				image, err := Open(path, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer image.Close()
+
+				manifest := verifyImage(t, image)
+				if manifest.Config.Digest != digest.FromBytes(config) || manifest.Config.MediaType != ociimagespec.MediaTypeImageConfig {
+					t.Errorf("config = %+v, want the digest of the config file", manifest.Config)
+				}
+				if len(manifest.Layers) != 1 || manifest.Layers[0].Digest != digest.FromBytes(layer) {
+					t.Errorf("layers = %+v, want the digest of the layer file", manifest.Layers)
+				}
+			})
+		}
+	}
+
+	if _, err := Open(saveTar, "other"); err == nil {
+		t.Error("Open() of a missing image succeeded")
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "readme", []byte("not an image"))
+
+	if _, err := Open(dir, ""); err == nil {
+		t.Error("Open() of a directory that is not an image succeeded")
+	}
+	if _, err := Open(filepath.Join(dir, "readme"), ""); err == nil {
+		t.Error("Open() of a file that is not a tarball succeeded")
+	}
+	if _, err := Open(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Error("Open() of a missing path succeeded")
+	}
+}
+
+// writeImage writes an image of a single layer to w, tagged with name.
+func writeImage(t *testing.T, w *Writer, name, layer string) ociimagespec.Descriptor {
+	t.Helper()
+
+	config := writeBlob(t, w, ociimagespec.MediaTypeImageConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	manifestBytes, err := json.Marshal(ociimagespec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ociimagespec.Descriptor{writeBlob(t, w, ociimagespec.MediaTypeImageLayer, []byte(layer))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := writeBlob(t, w, ociimagespec.MediaTypeImageManifest, manifestBytes)
+	if err = w.Tag(root, name); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// writeBlob writes data to w and returns its descriptor.
+func writeBlob(t *testing.T, w *Writer, mediaType string, data []byte) ociimagespec.Descriptor {
+	t.Helper()
+
+	desc := ociimagespec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	if err := w.WriteBlob(desc, data); err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+// verifyImage reads the manifest of image and verifies that it and all its blobs match their digests.
+func verifyImage(t *testing.T, image *Image) ociimagespec.Manifest {
+	t.Helper()
+
+	manifestBytes := readVerified(t, image, image.Root)
+
+	var manifest ociimagespec.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	readVerified(t, image, manifest.Config)
+	for _, layer := range manifest.Layers {
+		readVerified(t, image, layer)
+	}
+	return manifest
+}
+
+// readVerified reads the blob of desc from image and verifies its digest and size.
+func readVerified(t *testing.T, image *Image, desc ociimagespec.Descriptor) []byte {
+	t.Helper()
+
+	data, err := image.ReadBlob(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dgst := digest.FromBytes(data); dgst != desc.Digest || int64(len(data)) != desc.Size {
+		t.Fatalf("read %v of %v bytes, want %v of %v bytes", dgst, len(data), desc.Digest, desc.Size)
+	}
+	return data
+}
+
+// writeFile writes data to the named file under dir, creating its parents.
+func writeFile(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tarDir writes the files of dir to a tarball at path, optionally gzip compressed.
+func tarDir(t *testing.T, dir, path string, compress bool) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var out io.Writer = file
+	if compress {
+		gw := gzip.NewWriter(file)
+		defer gw.Close()
+		out = gw
+	}
+
+	tw := tar.NewWriter(out)
+	defer tw.Close()
+
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
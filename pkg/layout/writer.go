@@ -0,0 +1,93 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Writer writes images to an OCI image layout directory.
+type Writer struct {
+	dir string
+}
+
+// NewWriter creates an OCI image layout in dir, or opens the one already there.
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Join(dir, dirBlobs), 0755); err != nil {
+		return nil, err
+	}
+
+	layoutBytes, err := json.Marshal(ociimagespec.ImageLayout{Version: ociimagespec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, fileOCILayout), layoutBytes, 0644); err != nil {
+		return nil, err
+	}
+
+	return &Writer{dir: dir}, nil
+}
+
+// WriteBlob verifies data against desc and writes it under blobs/.
+func (w *Writer) WriteBlob(desc ociimagespec.Descriptor, data []byte) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return err
+	}
+
+	if got := desc.Digest.Algorithm().FromBytes(data); got != desc.Digest {
+		return fmt.Errorf("blob digest mismatch; expected: %v, got: %v", desc.Digest, got)
+	}
+	if int64(len(data)) != desc.Size {
+		return fmt.Errorf("blob size mismatch; expected: %v, got: %v", desc.Size, len(data))
+	}
+
+	dir := filepath.Join(w.dir, dirBlobs, desc.Digest.Algorithm().String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, desc.Digest.Hex()), data, 0644)
+}
+
+// Tag adds root to index.json with the given org.opencontainers.image.ref.name annotation, replacing any
+// image previously written with the same name.
+func (w *Writer) Tag(root ociimagespec.Descriptor, name string) error {
+	indexPath := filepath.Join(w.dir, fileIndex)
+
+	index := ociimagespec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageIndex,
+	}
+
+	indexBytes, err := ioutil.ReadFile(indexPath)
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(indexBytes, &index); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	manifests := index.Manifests[:0]
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ociimagespec.AnnotationRefName] != name {
+			manifests = append(manifests, desc)
+		}
+	}
+
+	root.Annotations = map[string]string{ociimagespec.AnnotationRefName: name}
+	index.Manifests = append(manifests, root)
+
+	indexBytes, err = json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(indexPath, indexBytes, 0644)
+}
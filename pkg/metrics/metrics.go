@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+)
+
+// Metric names.
+const (
+	namespace = "acr_checkhealth"
+
+	metricRequests        = namespace + "_requests_total"
+	metricRequestDuration = namespace + "_request_duration_seconds"
+	metricRequestBytes    = namespace + "_request_bytes_total"
+	metricResponseBytes   = namespace + "_response_bytes_total"
+	metricCheckSuccess    = namespace + "_check_success"
+	metricCheckDuration   = namespace + "_check_duration_seconds"
+	metricCheckLastRun    = namespace + "_check_last_run_timestamp_seconds"
+)
+
+// codeRoundTripFailed is the code label of round trips that got no response.
+const codeRoundTripFailed = "error"
+
+// ContentType is the content type of the text exposition format written by WriteText.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the request latency histogram.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// requestKey identifies the requests of an operation against a registry.
+type requestKey struct {
+	registry  string
+	operation string
+}
+
+// requestStats are the stats of the requests of an operation against a registry.
+type requestStats struct {
+	codes         map[string]uint64
+	buckets       []uint64
+	count         uint64
+	sum           float64
+	requestBytes  int64
+	responseBytes int64
+}
+
+// checkKey identifies a check against a registry.
+type checkKey struct {
+	registry string
+	check    string
+}
+
+// checkStats is the outcome of the last run of a check against a registry.
+type checkStats struct {
+	success  bool
+	duration time.Duration
+	lastRun  time.Time
+}
+
+// Collector collects metrics of registry round trips and checks, and writes them in the Prometheus text
+// exposition format.
+type Collector struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	requests map[requestKey]*requestStats
+	checks   map[checkKey]checkStats
+}
+
+// NewCollector returns a collector with the default latency buckets.
+func NewCollector() *Collector {
+	return &Collector{
+		buckets:  DefaultBuckets,
+		requests: make(map[requestKey]*requestStats),
+		checks:   make(map[checkKey]checkStats),
+	}
+}
+
+// Observer returns a function that records round trips made to the given registry. It can be used with
+// rhttp.Observe.
+func (c *Collector) Observer(registry string) func(rhttp.RoundTripInfo, error) {
+	return func(info rhttp.RoundTripInfo, err error) {
+		c.ObserveRoundTrip(registry, info, err)
+	}
+}
+
+// ObserveRoundTrip records a round trip made to the given registry.
+func (c *Collector) ObserveRoundTrip(registry string, info rhttp.RoundTripInfo, err error) {
+	code := codeRoundTripFailed
+	if err == nil || info.Response.Code != 0 {
+		code = strconv.Itoa(info.Response.Code)
+	}
+
+	// Round trips without an elapsed time are counted in the lowest bucket.
+	elapsed, _ := time.ParseDuration(info.Elapsed)
+
+	key := requestKey{registry: registry, operation: Operation(info)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.requests[key]
+	if !ok {
+		stats = &requestStats{
+			codes:   make(map[string]uint64),
+			buckets: make([]uint64, len(c.buckets)),
+		}
+		c.requests[key] = stats
+	}
+
+	stats.codes[code]++
+	stats.count++
+	stats.sum += elapsed.Seconds()
+	for i, bound := range c.buckets {
+		if elapsed.Seconds() <= bound {
+			stats.buckets[i]++
+		}
+	}
+	stats.requestBytes += info.Request.Size
+	stats.responseBytes += info.Response.Size
+}
+
+// ObserveCheck records the outcome of a check against the given registry.
+func (c *Collector) ObserveCheck(registry, check string, success bool, start time.Time, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks[checkKey{registry: registry, check: check}] = checkStats{
+		success:  success,
+		duration: duration,
+		lastRun:  start,
+	}
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format.
+func (c *Collector) WriteText(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	requestKeys := make([]requestKey, 0, len(c.requests))
+	for key := range c.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].registry != requestKeys[j].registry {
+			return requestKeys[i].registry < requestKeys[j].registry
+		}
+		return requestKeys[i].operation < requestKeys[j].operation
+	})
+
+	checkKeys := make([]checkKey, 0, len(c.checks))
+	for key := range c.checks {
+		checkKeys = append(checkKeys, key)
+	}
+	sort.Slice(checkKeys, func(i, j int) bool {
+		if checkKeys[i].registry != checkKeys[j].registry {
+			return checkKeys[i].registry < checkKeys[j].registry
+		}
+		return checkKeys[i].check < checkKeys[j].check
+	})
+
+	header(bw, metricRequests, "counter", "Registry requests by operation and response code.")
+	for _, key := range requestKeys {
+		stats := c.requests[key]
+		codes := make([]string, 0, len(stats.codes))
+		for code := range stats.codes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			sample(bw, metricRequests, labels("registry", key.registry, "operation", key.operation, "code", code), float64(stats.codes[code]))
+		}
+	}
+
+	header(bw, metricRequestDuration, "histogram", "Latency of registry requests by operation.")
+	for _, key := range requestKeys {
+		stats := c.requests[key]
+		for i, bound := range c.buckets {
+			sample(bw, metricRequestDuration+"_bucket",
+				labels("registry", key.registry, "operation", key.operation, "le", formatFloat(bound)), float64(stats.buckets[i]))
+		}
+		sample(bw, metricRequestDuration+"_bucket",
+			labels("registry", key.registry, "operation", key.operation, "le", "+Inf"), float64(stats.count))
+		sample(bw, metricRequestDuration+"_sum", labels("registry", key.registry, "operation", key.operation), stats.sum)
+		sample(bw, metricRequestDuration+"_count", labels("registry", key.registry, "operation", key.operation), float64(stats.count))
+	}
+
+	header(bw, metricRequestBytes, "counter", "Bytes sent in registry request bodies by operation.")
+	for _, key := range requestKeys {
+		sample(bw, metricRequestBytes, labels("registry", key.registry, "operation", key.operation), float64(c.requests[key].requestBytes))
+	}
+
+	header(bw, metricResponseBytes, "counter", "Bytes received in registry response bodies by operation.")
+	for _, key := range requestKeys {
+		sample(bw, metricResponseBytes, labels("registry", key.registry, "operation", key.operation), float64(c.requests[key].responseBytes))
+	}
+
+	header(bw, metricCheckSuccess, "gauge", "Whether the last run of a check was successful.")
+	for _, key := range checkKeys {
+		var success float64
+		if c.checks[key].success {
+			success = 1
+		}
+		sample(bw, metricCheckSuccess, labels("registry", key.registry, "check", key.check), success)
+	}
+
+	header(bw, metricCheckDuration, "gauge", "Duration of the last run of a check.")
+	for _, key := range checkKeys {
+		sample(bw, metricCheckDuration, labels("registry", key.registry, "check", key.check), c.checks[key].duration.Seconds())
+	}
+
+	header(bw, metricCheckLastRun, "gauge", "Unix time of the last run of a check.")
+	for _, key := range checkKeys {
+		sample(bw, metricCheckLastRun, labels("registry", key.registry, "check", key.check), float64(c.checks[key].lastRun.Unix()))
+	}
+
+	return bw.Flush()
+}
+
+// WriteFile writes the metrics to path for the node_exporter textfile collector. The file is replaced
+// atomically so that a partial file is never scraped.
+func (c *Collector) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := c.WriteText(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Temp files are only readable by the owner.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// header writes the HELP and TYPE lines of a metric.
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, kind)
+}
+
+// sample writes a sample of a metric.
+func sample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%v{%v} %v\n", name, labels, formatFloat(value))
+}
+
+// labels formats label name and value pairs.
+func labels(pairs ...string) string {
+	var formatted []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		formatted = append(formatted, fmt.Sprintf("%v=\"%v\"", pairs[i], escapeLabel(pairs[i+1])))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// escapeLabel escapes a label value as required by the text exposition format.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a sample value or a bucket bound.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	if err := c.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
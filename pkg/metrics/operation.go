@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+)
+
+// Operations of registry round trips.
+const (
+	OperationPing           = "ping"
+	OperationToken          = "token"
+	OperationBlobInit       = "blob-init"
+	OperationBlobPatch      = "blob-patch"
+	OperationBlobPut        = "blob-put"
+	OperationBlobGet        = "blob-get"
+	OperationBlobDelete     = "blob-delete"
+	OperationManifestPut    = "manifest-put"
+	OperationManifestGet    = "manifest-get"
+	OperationManifestDelete = "manifest-delete"
+	OperationSASDownload    = "sas-download"
+	OperationReferrers      = "referrers"
+	OperationTags           = "tags"
+	OperationCatalog        = "catalog"
+	OperationOther          = "other"
+)
+
+// Operation classifies a round trip by the registry API it calls.
+func Operation(info rhttp.RoundTripInfo) string {
+	u := info.Request.URL
+	if u == nil {
+		return OperationOther
+	}
+
+	query := u.Query()
+	path := u.Path
+
+	switch {
+	// Shared access signatures of blob downloads
+	case query.Get("sig") != "":
+		return OperationSASDownload
+	case strings.Contains(path, "/oauth2/token") || query.Get("scope") != "" || query.Get("service") != "":
+		return OperationToken
+	case path == "/v2/" || path == "/v2" || path == "/" || path == "":
+		return OperationPing
+	// Blob downloads redirected outside of the registry API, such as to storage or a CDN
+	case !strings.HasPrefix(path, "/v2/") && !strings.HasPrefix(path, "/oras/"):
+		return OperationSASDownload
+	case path == "/v2/_catalog":
+		return OperationCatalog
+	// ORAS referrers: /oras/artifacts/v1/<name>/manifests/<digest>/referrers
+	case strings.HasPrefix(path, "/oras/"):
+		if strings.HasSuffix(path, "/referrers") {
+			return OperationReferrers
+		}
+		return OperationOther
+	}
+
+	// Registry API routes are /v2/<name>/<route>/<reference>. A repository name may contain route names, such as
+	// team/referrers, so routes are matched from the end of the path.
+	segments := strings.Split(strings.TrimPrefix(path, "/v2/"), "/")
+	n := len(segments)
+	if n < 3 {
+		return OperationOther
+	}
+
+	switch segments[n-2] {
+	case "tags":
+		if segments[n-1] == "list" {
+			return OperationTags
+		}
+	case "referrers":
+		return OperationReferrers
+	case "uploads":
+		if n < 4 || segments[n-3] != "blobs" {
+			break
+		}
+		switch info.Request.Method {
+		case http.MethodPost:
+			return OperationBlobInit
+		case http.MethodPatch:
+			return OperationBlobPatch
+		case http.MethodPut:
+			return OperationBlobPut
+		}
+	case "blobs":
+		if info.Request.Method == http.MethodDelete {
+			return OperationBlobDelete
+		}
+		return OperationBlobGet
+	case "manifests":
+		switch info.Request.Method {
+		case http.MethodPut:
+			return OperationManifestPut
+		case http.MethodDelete:
+			return OperationManifestDelete
+		default:
+			return OperationManifestGet
+		}
+	}
+
+	return OperationOther
+}
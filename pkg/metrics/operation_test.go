@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+)
+
+func TestOperation(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   string
+	}{
+		{http.MethodGet, "https://r.azurecr.io/v2/", OperationPing},
+		{http.MethodGet, "https://r.azurecr.io/v2", OperationPing},
+		{http.MethodGet, "https://r.azurecr.io/oauth2/token?scope=repository:a:pull&service=r.azurecr.io", OperationToken},
+		{http.MethodPost, "https://r.azurecr.io/oauth2/token", OperationToken},
+		{http.MethodGet, "https://r.azurecr.io/v2/_catalog", OperationCatalog},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/b/tags/list", OperationTags},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/referrers/sha256:abc", OperationReferrers},
+		{http.MethodGet, "https://r.azurecr.io/oras/artifacts/v1/a/manifests/sha256:abc/referrers", OperationReferrers},
+		{http.MethodPost, "https://r.azurecr.io/v2/a/blobs/uploads/", OperationBlobInit},
+		{http.MethodPatch, "https://r.azurecr.io/v2/a/blobs/uploads/123", OperationBlobPatch},
+		{http.MethodPut, "https://r.azurecr.io/v2/a/blobs/uploads/123?digest=sha256:abc", OperationBlobPut},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/blobs/sha256:abc", OperationBlobGet},
+		{http.MethodHead, "https://r.azurecr.io/v2/a/blobs/sha256:abc", OperationBlobGet},
+		{http.MethodDelete, "https://r.azurecr.io/v2/a/blobs/sha256:abc", OperationBlobDelete},
+		{http.MethodPut, "https://r.azurecr.io/v2/a/manifests/v1", OperationManifestPut},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/manifests/v1", OperationManifestGet},
+		{http.MethodHead, "https://r.azurecr.io/v2/a/manifests/v1", OperationManifestGet},
+		{http.MethodDelete, "https://r.azurecr.io/v2/a/manifests/sha256:abc", OperationManifestDelete},
+		{http.MethodGet, "https://r.blob.core.windows.net/container/blob?sv=2019&sig=abc", OperationSASDownload},
+		{http.MethodGet, "https://r.cdn.azurecr.io/blobs/abc", OperationSASDownload},
+		{http.MethodGet, "https://r.azurecr.io/v2/team/referrers/manifests/v1", OperationManifestGet},
+		{http.MethodGet, "https://r.azurecr.io/v2/team/referrers/tags/list", OperationTags},
+		{http.MethodGet, "https://r.azurecr.io/v2/team/manifests/referrers/sha256:abc", OperationReferrers},
+		{http.MethodPut, "https://r.azurecr.io/v2/team/blobs/manifests/v1", OperationManifestPut},
+		{http.MethodGet, "https://r.azurecr.io/v2/team/blobs/uploads/blobs/sha256:abc", OperationBlobGet},
+		{http.MethodPost, "https://r.azurecr.io/v2/team/blobs/blobs/uploads/", OperationBlobInit},
+		{http.MethodPatch, "https://r.azurecr.io/v2/team/manifests/blobs/uploads/123", OperationBlobPatch},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/manifests/referrers", OperationManifestGet},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/unknown", OperationOther},
+		{http.MethodGet, "https://r.azurecr.io/v2/a/uploads/123", OperationOther},
+		{http.MethodGet, "https://r.azurecr.io/v2/manifests/v1", OperationOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info := rhttp.RoundTripInfo{Request: rhttp.Request{Method: tt.method, URL: u}}
+			if got := Operation(info); got != tt.want {
+				t.Errorf("Operation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := Operation(rhttp.RoundTripInfo{}); got != OperationOther {
+		t.Errorf("Operation() without a URL = %v, want %v", got, OperationOther)
+	}
+}
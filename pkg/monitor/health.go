@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Health is the health of a check, a target or all targets.
+type Health string
+
+// Health statuses.
+const (
+	// HealthPending means a check has not run yet, such as right after the monitor started.
+	HealthPending   Health = "pending"
+	HealthHealthy   Health = "healthy"
+	HealthUnhealthy Health = "unhealthy"
+)
+
+// HealthReport is the health of all targets, or of a single target.
+type HealthReport struct {
+	Status  Health         `json:"status"`
+	Time    time.Time      `json:"time"`
+	Targets []TargetStatus `json:"registries"`
+}
+
+// TargetStatus is the health of the checks against a target. It is healthy when the last run of every check
+// succeeded.
+type TargetStatus struct {
+	Name   string        `json:"name"`
+	Status Health        `json:"status"`
+	Checks []CheckStatus `json:"checks"`
+}
+
+// CheckStatus is the health of a check, which is that of its last run.
+type CheckStatus struct {
+	CheckState
+	Status      Health  `json:"status"`
+	SuccessRate float64 `json:"successRate"`
+}
+
+// Health returns the health of the checks against the target.
+func (s TargetState) Health() TargetStatus {
+	health := TargetStatus{Name: s.Name}
+
+	for _, check := range s.Checks {
+		status := CheckStatus{CheckState: check, SuccessRate: check.SuccessRate()}
+		switch {
+		case check.Runs == 0:
+			status.Status = HealthPending
+		case check.Last.OK():
+			status.Status = HealthHealthy
+		default:
+			status.Status = HealthUnhealthy
+		}
+		health.Checks = append(health.Checks, status)
+	}
+
+	// CheckHealth is skipped while Ping fails, so a failing Ping alone makes the target unhealthy.
+	health.Status = worst(health.Checks)
+	return health
+}
+
+// HealthReport returns the health of every target.
+func (m *Monitor) HealthReport() HealthReport {
+	report := HealthReport{Time: time.Now(), Targets: []TargetStatus{}}
+	for _, state := range m.State() {
+		report.Targets = append(report.Targets, state.Health())
+	}
+	report.Status = worstTarget(report.Targets)
+	return report
+}
+
+// ServeHTTP serves the health of every target as JSON at the root path, and that of a single target at its
+// name, such as /myregistry.azurecr.io. Mount it with http.StripPrefix. The status is 200 if healthy, 503
+// if unhealthy or pending so that readiness probes fail until the first runs finish, and 404 for unknown
+// targets.
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := m.HealthReport()
+
+	if name := strings.Trim(r.URL.Path, "/"); name != "" {
+		var found bool
+		for _, target := range report.Targets {
+			if target.Name == name {
+				report.Targets = []TargetStatus{target}
+				report.Status = target.Status
+				found = true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, "unknown registry "+name, http.StatusNotFound)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != HealthHealthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// worst returns the worst health of the checks. Unhealthy is worse than pending.
+func worst(checks []CheckStatus) Health {
+	health := HealthHealthy
+	for _, check := range checks {
+		health = worse(health, check.Status)
+	}
+	return health
+}
+
+// worstTarget returns the worst health of the targets.
+func worstTarget(targets []TargetStatus) Health {
+	health := HealthHealthy
+	for _, target := range targets {
+		health = worse(health, target.Status)
+	}
+	return health
+}
+
+// worse returns the worse of two healths.
+func worse(a, b Health) Health {
+	if a == HealthUnhealthy || b == HealthUnhealthy {
+		return HealthUnhealthy
+	}
+	if a == HealthPending || b == HealthPending {
+		return HealthPending
+	}
+	return HealthHealthy
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServeHTTP(t *testing.T) {
+	ok := Result{Time: time.Now(), Duration: time.Millisecond}
+	failed := Result{Time: time.Now(), Duration: time.Millisecond, Error: "boom"}
+
+	m := New([]Target{{Name: "healthy.azurecr.io"}, {Name: "unhealthy.azurecr.io"}, {Name: "pending.azurecr.io"}},
+		Options{Window: 10}, zerolog.Nop())
+	m.record(0, 0, ok)
+	m.record(0, 1, ok)
+	m.record(1, 0, ok)
+	m.record(1, 1, failed)
+	m.record(2, 0, ok)
+
+	tests := []struct {
+		path       string
+		wantCode   int
+		wantStatus Health
+		wantCount  int
+	}{
+		{"/", http.StatusServiceUnavailable, HealthUnhealthy, 3},
+		{"/healthy.azurecr.io", http.StatusOK, HealthHealthy, 1},
+		{"/unhealthy.azurecr.io", http.StatusServiceUnavailable, HealthUnhealthy, 1},
+		{"/pending.azurecr.io", http.StatusServiceUnavailable, HealthPending, 1},
+		{"/unknown.azurecr.io", http.StatusNotFound, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("code = %v, want %v", w.Code, tt.wantCode)
+			}
+			if tt.wantCode == http.StatusNotFound {
+				return
+			}
+
+			var report HealthReport
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", report.Status, tt.wantStatus)
+			}
+			if len(report.Targets) != tt.wantCount {
+				t.Errorf("got %v registries, want %v", len(report.Targets), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestServeHTTPHealthy(t *testing.T) {
+	m := New([]Target{{Name: "a.azurecr.io"}, {Name: "b.azurecr.io"}}, Options{}, zerolog.Nop())
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("code before the first runs = %v, want %v", w.Code, http.StatusServiceUnavailable)
+	}
+
+	for i := range m.targets {
+		m.record(i, 0, Result{Time: time.Now()})
+		m.record(i, 1, Result{Time: time.Now()})
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("code after the first runs = %v, want %v", w.Code, http.StatusOK)
+	}
+}
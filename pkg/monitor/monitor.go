@@ -0,0 +1,274 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
+	"github.com/rs/zerolog"
+)
+
+// Repository is the repository CheckHealth runs push to, unless configured otherwise. Every run reuses it,
+// so that a long-lived monitor does not leave a repository behind per run.
+const Repository = "acrcheckhealth-monitor"
+
+// Checks run against each target, in order.
+const (
+	CheckPing   = "ping"
+	CheckHealth = "check-health"
+)
+
+// Target is a registry to monitor.
+type Target struct {
+	// Name identifies the target, such as its login server.
+	Name string
+
+	// Proxy is used to run checks against the target.
+	Proxy *registry.Proxy
+}
+
+// Options configures a monitor.
+type Options struct {
+	// Interval is the average time between check runs against a target.
+	Interval time.Duration
+
+	// Jitter is the maximum random deviation from the interval, so that targets are not checked in lockstep.
+	Jitter time.Duration
+
+	// Window is the number of recent results used for success rates and latencies.
+	Window int
+
+	// Health configures the CheckHealth runs.
+	Health registry.HealthOptions
+
+	// Tracer, if set, traces every check run as a trace of its own.
+	Tracer *tracing.Tracer
+
+	// OnResult, if set, is called with the result of every check run.
+	OnResult func(target, check string, result Result)
+}
+
+// Result is the outcome of a single check run.
+type Result struct {
+	Time     time.Time              `json:"time"`
+	Duration time.Duration          `json:"duration"`
+	Error    string                 `json:"error,omitempty"`
+	Category registry.ErrorCategory `json:"category,omitempty"`
+}
+
+// OK reports whether the check succeeded.
+func (r Result) OK() bool {
+	return r.Error == ""
+}
+
+// CheckState is the rolling state of a check against a target.
+type CheckState struct {
+	Name string `json:"name"`
+
+	// Runs and Failures count all runs since the monitor started.
+	Runs     int `json:"runs"`
+	Failures int `json:"failures"`
+
+	// ConsecutiveFailures counts failures since the last success.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	Last Result `json:"last"`
+
+	// Window holds the most recent results, oldest first.
+	Window []Result `json:"-"`
+}
+
+// SuccessRate returns the fraction of successful runs in the window.
+func (s CheckState) SuccessRate() float64 {
+	if len(s.Window) == 0 {
+		return 0
+	}
+
+	var ok int
+	for _, r := range s.Window {
+		if r.OK() {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(s.Window))
+}
+
+// Latencies returns the durations of successful runs in the window.
+func (s CheckState) Latencies() registry.Latencies {
+	var latencies registry.Latencies
+	for _, r := range s.Window {
+		if r.OK() {
+			latencies = append(latencies, r.Duration)
+		}
+	}
+	return latencies
+}
+
+// TargetState is the state of the checks against a target.
+type TargetState struct {
+	Name   string       `json:"name"`
+	Checks []CheckState `json:"checks"`
+}
+
+// Monitor runs checks against targets on a schedule and keeps their state.
+type Monitor struct {
+	targets []Target
+	opts    Options
+	logger  zerolog.Logger
+
+	mu     sync.Mutex
+	states []TargetState
+}
+
+// New returns a monitor of the given targets.
+func New(targets []Target, opts Options, logger zerolog.Logger) *Monitor {
+	if opts.Window < 1 {
+		opts.Window = 1
+	}
+	if opts.Health.Repository == "" {
+		opts.Health.Repository = Repository
+	}
+
+	states := make([]TargetState, len(targets))
+	for i, target := range targets {
+		states[i] = TargetState{
+			Name:   target.Name,
+			Checks: []CheckState{{Name: CheckPing}, {Name: CheckHealth}},
+		}
+	}
+
+	return &Monitor{
+		targets: targets,
+		opts:    opts,
+		logger:  logger,
+		states:  states,
+	}
+}
+
+// Run checks every target until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range m.targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.runTarget(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// State returns a copy of the state of every target.
+func (m *Monitor) State() []TargetState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := make([]TargetState, len(m.states))
+	for i, state := range m.states {
+		states[i] = TargetState{Name: state.Name, Checks: make([]CheckState, len(state.Checks))}
+		for j, check := range state.Checks {
+			check.Window = append([]Result(nil), check.Window...)
+			states[i].Checks[j] = check
+		}
+	}
+	return states
+}
+
+// runTarget runs the checks of a target on a jittered schedule until ctx is done.
+func (m *Monitor) runTarget(ctx context.Context, i int) {
+	// Spread the first runs of targets.
+	delay := m.jitter() + m.opts.Jitter
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		target := m.targets[i]
+
+		pingResult := m.run(target, CheckPing, func(p registry.Proxy) error { return p.Ping() })
+		m.record(i, 0, pingResult)
+
+		// Pushing and pulling is pointless if the registry cannot be reached.
+		if pingResult.OK() {
+			m.record(i, 1, m.run(target, CheckHealth, func(p registry.Proxy) error { return p.CheckHealth(m.opts.Health) }))
+		}
+
+		delay = m.opts.Interval + m.jitter()
+	}
+}
+
+// jitter returns a random duration between -Jitter and +Jitter.
+func (m *Monitor) jitter() time.Duration {
+	if m.opts.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(2*m.opts.Jitter))) - m.opts.Jitter
+}
+
+// run runs a check against a target and returns its result.
+func (m *Monitor) run(target Target, name string, check func(registry.Proxy) error) Result {
+	span := m.opts.Tracer.Start(name)
+	span.SetAttribute("acr.login_server", target.Name)
+
+	proxy := *target.Proxy
+	proxy.Span = span
+
+	start := time.Now()
+	err := check(proxy)
+
+	result := Result{
+		Time:     start,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Category = registry.Classify(err)
+		span.SetAttribute("acr.error_category", string(result.Category))
+	}
+	span.End(err)
+
+	return result
+}
+
+// record adds the result of a check of a target to its state, and logs it.
+func (m *Monitor) record(i, j int, result Result) {
+	m.mu.Lock()
+
+	check := &m.states[i].Checks[j]
+	check.Runs++
+	check.Last = result
+	if result.OK() {
+		check.ConsecutiveFailures = 0
+	} else {
+		check.Failures++
+		check.ConsecutiveFailures++
+	}
+
+	check.Window = append(check.Window, result)
+	if len(check.Window) > m.opts.Window {
+		check.Window = check.Window[len(check.Window)-m.opts.Window:]
+	}
+
+	summary := fmt.Sprintf("%v %v: success rate %.1f%% of last %v, latency %v",
+		m.states[i].Name, check.Name, check.SuccessRate()*100, len(check.Window), check.Latencies())
+
+	m.mu.Unlock()
+
+	if result.OK() {
+		m.logger.Info().Msg(fmt.Sprintf("%v %v was successful in %v", m.states[i].Name, check.Name, result.Duration))
+	} else {
+		m.logger.Error().Str("category", string(result.Category)).Msg(fmt.Sprintf("%v %v failed: %v", m.states[i].Name, check.Name, result.Error))
+	}
+	m.logger.Info().Msg(summary)
+
+	if m.opts.OnResult != nil {
+		m.opts.OnResult(m.states[i].Name, check.Name, result)
+	}
+}
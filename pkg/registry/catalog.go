@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Catalog routes
+const (
+	routeCatalog = "/v2/_catalog"
+)
+
+// catalogResponse describes the _catalog API response.
+type catalogResponse struct {
+	// Repositories is a page of repository names.
+	Repositories []string `json:"repositories"`
+}
+
+// CatalogOptions configures the catalog check.
+type CatalogOptions struct {
+	// PageSize is the number of repositories to request per page. Zero lets the registry decide.
+	PageSize int
+
+	// Timeout is the maximum time to wait for the new repository to show up in the catalog.
+	Timeout time.Duration
+
+	// Interval is the time to wait between catalog listings.
+	Interval time.Duration
+}
+
+// CheckCatalog pushes an image to a new repository and polls the _catalog API until the repository is listed.
+// ACR eventually indexes new repositories, so the time until the repository is visible is reported along
+// with the latency of each listing.
+func (p Proxy) CheckCatalog(opts CatalogOptions) error {
+	var (
+		repo = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		tag  = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	// Push simple image
+	if _, err := p.pushOCIImage(repo, tag); err != nil {
+		return err
+	}
+	pushedAt := time.Now()
+
+	p.Logger.Info().Msg(fmt.Sprintf("wait for %v to appear in catalog", repo))
+
+	for attempt := 1; ; attempt++ {
+		found, pages, elapsed, err := p.findInCatalog(repo, opts.PageSize)
+		if err != nil {
+			return err
+		}
+
+		p.Logger.Info().Msg(fmt.Sprintf("catalog listing %v: %v pages in %v", attempt, pages, elapsed))
+
+		if found {
+			p.Logger.Info().Msg(fmt.Sprintf("%v visible in catalog after %v", repo, time.Since(pushedAt)))
+			break
+		}
+
+		if time.Since(pushedAt) > opts.Timeout {
+			return fmt.Errorf("%v not visible in catalog after %v", repo, opts.Timeout)
+		}
+
+		time.Sleep(opts.Interval)
+	}
+
+	p.Logger.Info().Msg("check-catalog was successful")
+
+	return nil
+}
+
+// findInCatalog walks all pages of the _catalog API looking for repo. It returns whether the repository
+// was found, the number of pages read and the time taken.
+func (p Proxy) findInCatalog(repo string, pageSize int) (found bool, pages int, elapsed time.Duration, err error) {
+	catalogURL := p.url(p.LoginServer, routeCatalog)
+	if pageSize > 0 {
+		catalogURL = fmt.Sprintf("%v?n=%v", catalogURL, pageSize)
+	}
+
+	start := time.Now()
+	for {
+		regReq := registryRequest{
+			method: http.MethodGet,
+			url:    catalogURL,
+		}
+
+		pages++
+
+		p.Logger.Debug().Msg(fmt.Sprintf("enumerating catalog page %v, %v", pages, regReq.url))
+
+		tripInfo, err := p.roundTrip(regReq, http.StatusOK, p.auth())
+		if err != nil {
+			return false, pages, time.Since(start), err
+		}
+
+		var resp catalogResponse
+		if err := json.Unmarshal(tripInfo.Body, &resp); err != nil {
+			return false, pages, time.Since(start), err
+		}
+
+		p.Logger.Debug().Msg(fmt.Sprintf("catalog page %v: %v repositories in %v", pages, len(resp.Repositories), tripInfo.Elapsed))
+
+		for _, r := range resp.Repositories {
+			if r == repo {
+				return true, pages, time.Since(start), nil
+			}
+		}
+
+		if tripInfo.HeaderLink == "" {
+			break
+		}
+
+		catalogURL, err = p.nextLink(tripInfo.HeaderLink)
+		if err != nil {
+			return false, pages, time.Since(start), err
+		}
+	}
+
+	return false, pages, time.Since(start), nil
+}
+
+// nextLink resolves the URL in an RFC 5988 Link header, such as `</v2/_catalog?last=a&n=10>; rel="next"`.
+// Registries may return a path relative to the login server.
+func (p Proxy) nextLink(link string) (string, error) {
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("invalid link header: %v", link)
+	}
+
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return "", err
+	}
+
+	base, err := url.Parse(p.url(p.LoginServer, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(next).String(), nil
+}
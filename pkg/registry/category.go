@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrorCategory classifies a failure by the component that most likely caused it, so that alerts can be
+// routed to the right team.
+type ErrorCategory string
+
+// Error categories.
+const (
+	ErrorCategoryUnknown       ErrorCategory = "unknown"
+	ErrorCategoryDNS           ErrorCategory = "dns"
+	ErrorCategoryConnect       ErrorCategory = "connect"
+	ErrorCategoryTLS           ErrorCategory = "tls"
+	ErrorCategoryAuthChallenge ErrorCategory = "auth-challenge"
+	ErrorCategoryTokenServer   ErrorCategory = "token-server"
+	ErrorCategoryAuthorization ErrorCategory = "authorization"
+	ErrorCategoryThrottling    ErrorCategory = "throttling"
+	ErrorCategoryServerError   ErrorCategory = "server-error"
+	ErrorCategoryRequest       ErrorCategory = "request"
+	ErrorCategoryDataIntegrity ErrorCategory = "data-integrity"
+	ErrorCategoryDataEndpoint  ErrorCategory = "data-endpoint"
+)
+
+// exitCodes are the process exit codes of each category.
+var exitCodes = map[ErrorCategory]int{
+	ErrorCategoryUnknown:       1,
+	ErrorCategoryDNS:           10,
+	ErrorCategoryConnect:       11,
+	ErrorCategoryTLS:           12,
+	ErrorCategoryAuthChallenge: 20,
+	ErrorCategoryTokenServer:   21,
+	ErrorCategoryAuthorization: 22,
+	ErrorCategoryThrottling:    30,
+	ErrorCategoryServerError:   31,
+	ErrorCategoryRequest:       32,
+	ErrorCategoryDataIntegrity: 40,
+	ErrorCategoryDataEndpoint:  41,
+}
+
+// ExitCode returns the process exit code for the category.
+func (c ErrorCategory) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+	return exitCodes[ErrorCategoryUnknown]
+}
+
+// categoryError is an error with an explicit category.
+type categoryError struct {
+	category ErrorCategory
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() error {
+	return e.err
+}
+
+// withCategory returns err with the given category, or nil if err is nil.
+func withCategory(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categoryError{category: category, err: err}
+}
+
+// integrityError returns a data integrity error, such as a size or digest mismatch.
+func integrityError(format string, a ...interface{}) error {
+	return withCategory(ErrorCategoryDataIntegrity, fmt.Errorf(format, a...))
+}
+
+// serverCategory returns the category of a response code that means the server could not handle the request
+// whatever it was, such as throttling or a server error, so that it is not attributed to the step that got it.
+func serverCategory(code int) (ErrorCategory, bool) {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ErrorCategoryThrottling, true
+	case code >= http.StatusInternalServerError:
+		return ErrorCategoryServerError, true
+	default:
+		return "", false
+	}
+}
+
+// Classify returns the category of err. Explicit categories take precedence, followed by unexpected
+// response codes and network errors.
+func Classify(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+
+	var categorized *categoryError
+	if errors.As(err, &categorized) {
+		return categorized.category
+	}
+
+	var registryErr *Error
+	if errors.As(err, &registryErr) {
+		code := registryErr.StatusCode
+		if category, ok := serverCategory(code); ok {
+			return category
+		}
+		if code == http.StatusUnauthorized || code == http.StatusForbidden {
+			return ErrorCategoryAuthorization
+		}
+		return ErrorCategoryRequest
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorCategoryDNS
+	}
+
+	var (
+		unknownAuthorityErr x509.UnknownAuthorityError
+		hostnameErr         x509.HostnameError
+		certificateErr      x509.CertificateInvalidError
+		recordHeaderErr     tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certificateErr) ||
+		errors.As(err, &recordHeaderErr) || strings.Contains(err.Error(), "tls: ") {
+		return ErrorCategoryTLS
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorCategoryConnect
+	}
+
+	return ErrorCategoryUnknown
+}
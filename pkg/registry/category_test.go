@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestClassify(t *testing.T) {
+	statusError := func(code int) error {
+		return &Error{RequestInfo: RequestInfo{StatusCode: code}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{"nil", nil, ""},
+		{"plain", errors.New("boom"), ErrorCategoryUnknown},
+		{"explicit", withCategory(ErrorCategoryTokenServer, statusError(http.StatusInternalServerError)), ErrorCategoryTokenServer},
+		{"wrapped explicit", fmt.Errorf("step: %w", integrityError("digest mismatch")), ErrorCategoryDataIntegrity},
+		{"401", statusError(http.StatusUnauthorized), ErrorCategoryAuthorization},
+		{"403", statusError(http.StatusForbidden), ErrorCategoryAuthorization},
+		{"429", statusError(http.StatusTooManyRequests), ErrorCategoryThrottling},
+		{"500", statusError(http.StatusInternalServerError), ErrorCategoryServerError},
+		{"503", statusError(http.StatusServiceUnavailable), ErrorCategoryServerError},
+		{"400", statusError(http.StatusBadRequest), ErrorCategoryRequest},
+		{"404", statusError(http.StatusNotFound), ErrorCategoryRequest},
+		{"wrapped status", fmt.Errorf("step: %w", statusError(http.StatusBadGateway)), ErrorCategoryServerError},
+		{"dns", &url.Error{Op: "Get", URL: "https://example.azurecr.io", Err: &net.DNSError{Err: "no such host", Name: "example.azurecr.io"}}, ErrorCategoryDNS},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://example.azurecr.io", Err: x509.UnknownAuthorityError{}}, ErrorCategoryTLS},
+		{"tls message", errors.New("remote error: tls: handshake failure"), ErrorCategoryTLS},
+		{"connect", &url.Error{Op: "Get", URL: "https://example.azurecr.io", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, ErrorCategoryConnect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	seen := make(map[int]ErrorCategory)
+	for category, code := range exitCodes {
+		if code == 0 {
+			t.Errorf("%v exits with 0", category)
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("%v and %v both exit with %v", category, other, code)
+		}
+		seen[code] = category
+	}
+
+	if got := ErrorCategory("made-up").ExitCode(); got != ErrorCategoryUnknown.ExitCode() {
+		t.Errorf("ExitCode() of an undefined category = %v, want %v", got, ErrorCategoryUnknown.ExitCode())
+	}
+}
+
+func TestPingCategory(t *testing.T) {
+	tests := []struct {
+		code int
+		want ErrorCategory
+	}{
+		{http.StatusOK, ErrorCategoryAuthChallenge},
+		{http.StatusNotFound, ErrorCategoryAuthChallenge},
+		{http.StatusTooManyRequests, ErrorCategoryThrottling},
+		{http.StatusInternalServerError, ErrorCategoryServerError},
+		{http.StatusServiceUnavailable, ErrorCategoryServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.code), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+			}))
+			defer server.Close()
+
+			proxy, err := NewProxy(http.DefaultTransport, &Options{
+				LoginServer: server.Listener.Addr().String(),
+				Insecure:    true,
+			}, zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := Classify(proxy.Ping()); got != tt.want {
+				t.Errorf("Classify(Ping()) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
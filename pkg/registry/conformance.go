@@ -0,0 +1,863 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// SpecURL is the OCI distribution-spec. Conformance sections are anchors in it.
+const SpecURL = "https://github.com/opencontainers/distribution-spec/blob/main/spec.md"
+
+// routeTags lists the tags of a repository.
+const routeTags = "/v2/%s/tags/list" // add repo name
+
+// Conformance categories of the OCI distribution-spec.
+const (
+	CategoryPull              = "pull"
+	CategoryPush              = "push"
+	CategoryContentDiscovery  = "content discovery"
+	CategoryContentManagement = "content management"
+)
+
+// Conformance outcomes.
+const (
+	OutcomePass = "pass"
+	OutcomeFail = "fail"
+	OutcomeSkip = "skip"
+)
+
+// ConformanceResult is the outcome of checking a single spec requirement.
+type ConformanceResult struct {
+	Category    string `json:"category"`
+	Section     string `json:"section"`
+	Requirement string `json:"requirement"`
+	Outcome     string `json:"outcome"`
+	Reason      string `json:"reason,omitempty"`
+
+	// ErrorCategory and ErrorCodes classify the failure of a failed requirement.
+	ErrorCategory ErrorCategory `json:"errorCategory,omitempty"`
+	ErrorCodes    []string      `json:"errorCodes,omitempty"`
+
+	// Request identifies the request that failed, if known.
+	Request *RequestInfo `json:"request,omitempty"`
+}
+
+// skipError is returned by a conformance check that does not apply to the registry, or whose prerequisite
+// failed.
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+// conformanceState is shared by the checks of a conformance run. Later checks use the content pushed by
+// earlier ones.
+type conformanceState struct {
+	repo          string
+	tag           string
+	config        *ociimagespec.Descriptor
+	layer         *ociimagespec.Descriptor
+	manifest      *ociimagespec.Descriptor
+	manifestBytes []byte
+	referrer      *ociimagespec.Descriptor
+}
+
+// conformanceCheck checks a spec requirement.
+type conformanceCheck struct {
+	category    string
+	section     string
+	requirement string
+	check       func(p Proxy, s *conformanceState) error
+}
+
+// conformanceChecks are run in order.
+var conformanceChecks = []conformanceCheck{
+	{CategoryPush, "pushing-a-blob-monolithically", "POST then PUT with the digest uploads a blob", checkMonolithicUpload},
+	{CategoryPush, "pushing-a-blob-in-chunks", "POST, PATCH then PUT with the digest uploads a blob", checkChunkedUpload},
+	{CategoryPush, "pushing-a-blob-monolithically", "a single POST with the digest uploads a blob", checkSinglePostUpload},
+	{CategoryPush, "mounting-a-blob-from-another-repository", "POST with mount and from mounts a blob", checkBlobMount},
+	{CategoryPush, "pushing-manifests", "PUT uploads a manifest by tag", checkPushManifestByTag},
+	{CategoryPush, "pushing-manifests", "PUT uploads a manifest by digest", checkPushManifestByDigest},
+	{CategoryPush, "pushing-manifests-with-subject", "PUT uploads a manifest with a subject", checkPushManifestWithSubject},
+	{CategoryPull, "pulling-manifests", "GET returns a manifest by tag", checkPullManifestByTag},
+	{CategoryPull, "pulling-manifests", "GET returns a manifest by digest", checkPullManifestByDigest},
+	{CategoryPush, "error-codes", "PUT of a manifest that is not JSON returns MANIFEST_INVALID", checkPushInvalidManifest},
+	{CategoryPush, "error-codes", "PUT of a manifest with a mismatched media type returns MANIFEST_INVALID", checkPushMismatchedMediaType},
+	{CategoryPush, "error-codes", "PUT of a manifest with unknown blobs returns MANIFEST_BLOB_UNKNOWN", checkPushManifestUnknownBlob},
+	{CategoryPush, "error-codes", "PUT of a manifest by a wrong digest returns DIGEST_INVALID", checkPushManifestWrongDigest},
+	{CategoryPush, "error-codes", "PUT completing an upload with a wrong digest returns DIGEST_INVALID", checkUploadWrongDigest},
+	{CategoryPush, "error-codes", "PATCH to an unknown upload returns BLOB_UPLOAD_UNKNOWN", checkUnknownUpload},
+	{CategoryPull, "error-codes", "GET of an unknown manifest returns 404 MANIFEST_UNKNOWN", checkPullUnknownManifest},
+	{CategoryPull, "checking-if-content-exists-in-the-registry", "HEAD returns 200 for an existing manifest", checkHeadManifest},
+	{CategoryPull, "pulling-blobs", "GET returns a blob", checkPullBlob},
+	{CategoryPull, "error-codes", "GET of an unknown blob returns 404 BLOB_UNKNOWN", checkPullUnknownBlob},
+	{CategoryPull, "error-codes", "GET of a manifest in an unknown repository returns 404 NAME_UNKNOWN", checkPullUnknownRepository},
+	{CategoryPull, "checking-if-content-exists-in-the-registry", "HEAD returns 200 for an existing blob", checkHeadBlob},
+	{CategoryContentDiscovery, "listing-tags", "GET lists the tags of a repository", checkListTags},
+	{CategoryContentDiscovery, "listing-tags", "GET with n limits the number of tags", checkListTagsPage},
+	{CategoryContentDiscovery, "listing-referrers", "GET lists the referrers of a manifest", checkListReferrers},
+	{CategoryContentDiscovery, "listing-referrers", "GET with artifactType filters referrers", checkListReferrersFilter},
+	{CategoryContentManagement, "deleting-tags", "DELETE removes a tag but not its manifest", checkDeleteTag},
+	{CategoryContentManagement, "deleting-manifests", "DELETE removes a manifest by digest", checkDeleteManifest},
+	{CategoryContentManagement, "deleting-blobs", "DELETE removes a blob", checkDeleteBlob},
+}
+
+// CheckConformance runs a suite modeled on the OCI distribution-spec conformance categories and returns the
+// outcome of each requirement. An error is returned if any requirement failed.
+func (p Proxy) CheckConformance() ([]ConformanceResult, error) {
+	s := &conformanceState{
+		repo: fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix()),
+		tag:  fmt.Sprintf("%v", time.Now().Unix()),
+	}
+
+	var (
+		results []ConformanceResult
+		failed  int
+	)
+
+	for _, c := range conformanceChecks {
+		p.Logger.Info().Msg(fmt.Sprintf("%v: %v", c.category, c.requirement))
+
+		result := ConformanceResult{
+			Category:    c.category,
+			Section:     c.section,
+			Requirement: c.requirement,
+			Outcome:     OutcomePass,
+		}
+
+		step, span := p.startSpan(c.requirement, "oci.conformance.section", c.section)
+		err := c.check(step, s)
+		if skip, ok := err.(skipError); ok {
+			result.Outcome = OutcomeSkip
+			result.Reason = string(skip)
+			p.Logger.Warn().Msg(fmt.Sprintf("skipped: %v", skip))
+		} else if err != nil {
+			result.Outcome = OutcomeFail
+			result.Reason = err.Error()
+			result.ErrorCategory = Classify(err)
+			var registryErr *Error
+			if errors.As(err, &registryErr) {
+				result.ErrorCodes = registryErr.Codes()
+			}
+			if request, ok := FailedRequest(err); ok {
+				result.Request = &request
+			}
+			failed++
+			p.Logger.Error().Msg(fmt.Sprintf("failed: %v", err))
+		}
+
+		span.SetAttribute("oci.conformance.outcome", result.Outcome)
+		if result.Outcome == OutcomeFail {
+			span.End(err)
+		} else {
+			span.End(nil)
+		}
+
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%v of %v conformance requirements failed", failed, len(results))
+	}
+
+	p.Logger.Info().Msg("check-conformance was successful")
+
+	return results, nil
+}
+
+// expectStatus returns an error unless the response code is one of the expected codes.
+func expectStatus(tripInfo rhttp.RoundTripInfo, expected ...int) error {
+	for _, code := range expected {
+		if tripInfo.Response.Code == code {
+			return nil
+		}
+	}
+	return newError(tripInfo, expected...)
+}
+
+// expectErrorCode returns an error unless the response has the expected code and its body has an error with
+// the expected distribution-spec error code.
+func expectErrorCode(tripInfo rhttp.RoundTripInfo, expected int, code string) error {
+	if err := expectStatus(tripInfo, expected); err != nil {
+		return err
+	}
+
+	registryErr := newError(tripInfo, expected)
+	if registryErr.HasCode(code) {
+		return nil
+	}
+	return &codeMismatchError{expected: code, response: registryErr}
+}
+
+// codeMismatchError is an error response without the expected distribution-spec error code. It wraps the
+// response, so that its error codes and request are reported.
+type codeMismatchError struct {
+	expected string
+	response *Error
+}
+
+func (e *codeMismatchError) Error() string {
+	if len(e.response.Errors) == 0 {
+		return e.response.withIDs(fmt.Sprintf("error code mismatch; expected: %v, got: no error body", e.expected))
+	}
+	return e.response.withIDs(fmt.Sprintf("error code mismatch; expected: %v, got: %v", e.expected, strings.Join(e.response.Codes(), ", ")))
+}
+
+func (e *codeMismatchError) Unwrap() error {
+	return e.response
+}
+
+// putManifest uploads manifestBytes to repo with the given reference and content type, and returns the
+// response whatever its code.
+func (p Proxy) putManifest(repo, reference, mediaType string, manifestBytes []byte) (rhttp.RoundTripInfo, error) {
+	regReq := registryRequest{
+		method:      http.MethodPut,
+		url:         p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, reference)),
+		body:        io.NewReader(strings.NewReader(string(manifestBytes))),
+		contentType: mediaType,
+	}
+	return p.roundTrip(regReq, anyStatusCode, p.auth())
+}
+
+// initiateUpload starts a blob upload in repo with the given query, and returns the response.
+func (p Proxy) initiateUpload(repo string, query url.Values, data io.Reader) (rhttp.RoundTripInfo, error) {
+	uploadURL := p.url(p.LoginServer, fmt.Sprintf(routeInitiateBlobUpload, repo))
+	if len(query) > 0 {
+		uploadURL += "?" + query.Encode()
+	}
+
+	regReq := registryRequest{
+		method: http.MethodPost,
+		url:    uploadURL,
+	}
+	if data != nil {
+		regReq.body = data
+		regReq.contentType = "application/octet-stream"
+	}
+
+	return p.roundTrip(regReq, anyStatusCode, p.auth())
+}
+
+func checkMonolithicUpload(p Proxy, s *conformanceState) error {
+	data := []byte(fmt.Sprintf(checkHealthLayerFmt, time.Now()))
+	dgst := digest.FromBytes(data)
+
+	tripInfo, err := p.initiateUpload(s.repo, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+	if tripInfo.HeaderLocation == nil {
+		return fmt.Errorf("missing Location header")
+	}
+
+	putURL := tripInfo.HeaderLocation
+	q := putURL.Query()
+	q.Set("digest", dgst.String())
+	putURL.RawQuery = q.Encode()
+
+	regReq := registryRequest{
+		method:      http.MethodPut,
+		url:         putURL.String(),
+		body:        io.NewReader(strings.NewReader(string(data))),
+		contentType: "application/octet-stream",
+	}
+	if tripInfo, err = p.roundTrip(regReq, anyStatusCode, p.auth()); err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusCreated); err != nil {
+		return err
+	}
+
+	s.layer = &ociimagespec.Descriptor{
+		MediaType: checkHealthMediaType,
+		Digest:    dgst,
+		Size:      int64(len(data)),
+	}
+	return nil
+}
+
+func checkChunkedUpload(p Proxy, s *conformanceState) error {
+	configBytes, err := json.Marshal(ociConfig)
+	if err != nil {
+		return err
+	}
+	dgst := digest.FromBytes(configBytes)
+
+	tripInfo, err := p.initiateUpload(s.repo, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+	if tripInfo.HeaderLocation == nil {
+		return fmt.Errorf("missing Location header")
+	}
+	uploadURL := tripInfo.HeaderLocation
+
+	// Upload two chunks, each with its Content-Range. The registry reports the range received so far.
+	half := len(configBytes) / 2
+	for _, chunk := range [][2]int{{0, half}, {half, len(configBytes)}} {
+		start, end := chunk[0], chunk[1]
+
+		regReq := registryRequest{
+			method:        http.MethodPatch,
+			url:           uploadURL.String(),
+			body:          io.NewReader(strings.NewReader(string(configBytes[start:end]))),
+			contentType:   "application/octet-stream",
+			contentRange:  fmt.Sprintf("%d-%d", start, end-1),
+			contentLength: int64(end - start),
+		}
+		if tripInfo, err = p.roundTrip(regReq, anyStatusCode, p.auth()); err != nil {
+			return err
+		}
+		if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+			return err
+		}
+		if got, want := tripInfo.Response.Header.Get(rhttp.HeaderRange), fmt.Sprintf("0-%d", end-1); got != want {
+			return fmt.Errorf("upload range mismatch; expected: %v, got: %v", want, got)
+		}
+		if tripInfo.HeaderLocation == nil {
+			return fmt.Errorf("missing Location header")
+		}
+		uploadURL = tripInfo.HeaderLocation
+	}
+
+	q := uploadURL.Query()
+	q.Set("digest", dgst.String())
+	uploadURL.RawQuery = q.Encode()
+
+	regReq := registryRequest{
+		method: http.MethodPut,
+		url:    uploadURL.String(),
+	}
+	if tripInfo, err = p.roundTrip(regReq, anyStatusCode, p.auth()); err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusCreated); err != nil {
+		return err
+	}
+
+	s.config = &ociimagespec.Descriptor{
+		MediaType: checkHealthMediaType,
+		Digest:    dgst,
+		Size:      int64(len(configBytes)),
+	}
+	return nil
+}
+
+func checkSinglePostUpload(p Proxy, s *conformanceState) error {
+	data := fmt.Sprintf(checkHealthLayerFmt+" ~ single post", time.Now())
+
+	tripInfo, err := p.initiateUpload(s.repo, url.Values{"digest": []string{digest.FromString(data).String()}}, io.NewReader(strings.NewReader(data)))
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code == http.StatusAccepted {
+		return skipError("registry started an upload session instead, which is allowed")
+	}
+	return expectStatus(tripInfo, http.StatusCreated)
+}
+
+func checkBlobMount(p Proxy, s *conformanceState) error {
+	if s.layer == nil {
+		return skipError("requires a pushed blob")
+	}
+
+	target := fmt.Sprintf("%v-mount", s.repo)
+	tripInfo, err := p.initiateUpload(target, url.Values{"mount": []string{s.layer.Digest.String()}, "from": []string{s.repo}}, nil)
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code == http.StatusAccepted {
+		return skipError("registry started an upload session instead of mounting, which is allowed")
+	}
+	return expectStatus(tripInfo, http.StatusCreated)
+}
+
+func checkPushManifestByTag(p Proxy, s *conformanceState) error {
+	if s.config == nil || s.layer == nil {
+		return skipError("requires pushed blobs")
+	}
+
+	manifest := ociimagespec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageManifest,
+		Config:    *s.config,
+		Layers:    []ociimagespec.Descriptor{*s.layer},
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	desc, err := p.v2PushManifest(s.repo, s.tag, ociimagespec.MediaTypeImageManifest, manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	s.manifest = &desc
+	s.manifestBytes = manifestBytes
+	return nil
+}
+
+func checkPushManifestByDigest(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	desc, err := p.v2PushManifest(s.repo, s.manifest.Digest.String(), s.manifest.MediaType, s.manifestBytes)
+	if err != nil {
+		return err
+	}
+	if desc.Digest != s.manifest.Digest {
+		return integrityError("manifest digest mismatch; expected: %v, got: %v", s.manifest.Digest, desc.Digest)
+	}
+	return nil
+}
+
+func checkPushManifestWithSubject(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	desc, err := p.pushReferrer(s.repo, "", *s.manifest, OciManifestReferrers, filterArtifactTypes[0], nil)
+	if err != nil {
+		return err
+	}
+
+	s.referrer = &desc
+	return nil
+}
+
+func checkPullManifestByTag(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	_, err := p.v2PullManifest(s.repo, s.tag, *s.manifest)
+	return err
+}
+
+func checkPullManifestByDigest(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	_, err := p.v2PullManifest(s.repo, s.manifest.Digest.String(), *s.manifest)
+	return err
+}
+
+func checkPullUnknownManifest(p Proxy, s *conformanceState) error {
+	tripInfo, err := p.v2GetManifest(s.repo, digest.FromString(s.repo+" unknown manifest").String(), ociimagespec.MediaTypeImageManifest, anyStatusCode)
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusNotFound, ErrorCodeManifestUnknown)
+}
+
+func checkPullUnknownRepository(p Proxy, s *conformanceState) error {
+	tripInfo, err := p.v2GetManifest(s.repo+"-unknown", s.tag, ociimagespec.MediaTypeImageManifest, anyStatusCode)
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusNotFound, ErrorCodeNameUnknown)
+}
+
+func checkHeadManifest(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	regReq := registryRequest{
+		method: http.MethodHead,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeManifest, s.repo, s.tag)),
+		accept: s.manifest.MediaType,
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	return expectStatus(tripInfo, http.StatusOK)
+}
+
+func checkPullBlob(p Proxy, s *conformanceState) error {
+	if s.layer == nil {
+		return skipError("requires a pushed blob")
+	}
+
+	regReq := registryRequest{
+		method: http.MethodGet,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeBlobPull, s.repo, s.layer.Digest)),
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+
+	// Registries may redirect to another location, such as a data endpoint.
+	switch tripInfo.Response.Code {
+	case http.StatusTemporaryRedirect, http.StatusFound, http.StatusSeeOther, http.StatusPermanentRedirect:
+		if tripInfo.HeaderLocation == nil {
+			return fmt.Errorf("missing Location header")
+		}
+		regReq = registryRequest{
+			method: http.MethodGet,
+			url:    tripInfo.HeaderLocation.String(),
+		}
+		if tripInfo, err = p.roundTrip(regReq, anyStatusCode, noAuth); err != nil {
+			return err
+		}
+	}
+
+	if err = expectStatus(tripInfo, http.StatusOK); err != nil {
+		return err
+	}
+	if tripInfo.Response.SHA256Sum != s.layer.Digest {
+		return withRequest(tripInfo, integrityError("blob digest mismatch; expected: %v, got: %v", s.layer.Digest, tripInfo.Response.SHA256Sum))
+	}
+	return nil
+}
+
+func checkPullUnknownBlob(p Proxy, s *conformanceState) error {
+	regReq := registryRequest{
+		method: http.MethodGet,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeBlobPull, s.repo, digest.FromString(s.repo+" unknown blob"))),
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusNotFound, ErrorCodeBlobUnknown)
+}
+
+func checkHeadBlob(p Proxy, s *conformanceState) error {
+	if s.layer == nil {
+		return skipError("requires a pushed blob")
+	}
+
+	regReq := registryRequest{
+		method: http.MethodHead,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeBlobPull, s.repo, s.layer.Digest)),
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	return expectStatus(tripInfo, http.StatusOK)
+}
+
+// tagsResponse is the response of the tags API.
+type tagsResponse struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// listTags returns a page of tags of repo.
+func (p Proxy) listTags(repo string, query url.Values) (tagsResponse, rhttp.RoundTripInfo, error) {
+	tagsURL := p.url(p.LoginServer, fmt.Sprintf(routeTags, repo))
+	if len(query) > 0 {
+		tagsURL += "?" + query.Encode()
+	}
+
+	var tags tagsResponse
+	tripInfo, err := p.roundTrip(registryRequest{method: http.MethodGet, url: tagsURL}, http.StatusOK, p.auth())
+	if err != nil {
+		return tags, tripInfo, err
+	}
+
+	err = json.Unmarshal(tripInfo.Body, &tags)
+	return tags, tripInfo, err
+}
+
+func checkListTags(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	tags, _, err := p.listTags(s.repo, nil)
+	if err != nil {
+		return err
+	}
+	if tags.Name != s.repo {
+		return fmt.Errorf("repository name mismatch; expected: %v, got: %v", s.repo, tags.Name)
+	}
+	for _, tag := range tags.Tags {
+		if tag == s.tag {
+			return nil
+		}
+	}
+	return fmt.Errorf("tag %v not listed in %v", s.tag, tags.Tags)
+}
+
+func checkListTagsPage(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	// A second tag, so that there is more than one page
+	if _, err := p.v2PushManifest(s.repo, s.tag+"-2", s.manifest.MediaType, s.manifestBytes); err != nil {
+		return err
+	}
+
+	tags, _, err := p.listTags(s.repo, url.Values{"n": []string{"1"}})
+	if err != nil {
+		return err
+	}
+	if len(tags.Tags) != 1 {
+		return fmt.Errorf("tags count mismatch; expected: 1, got: %v", len(tags.Tags))
+	}
+	return nil
+}
+
+func checkListReferrers(p Proxy, s *conformanceState) error {
+	if s.referrer == nil {
+		return skipError("requires a pushed manifest with a subject")
+	}
+
+	supported, err := p.referrersAPISupported(s.repo, s.manifest.Digest)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return skipError("registry does not support the referrers API, clients must use the referrers tag schema")
+	}
+
+	if err = p.waitForReferrers(s.repo, s.manifest.Digest, []ociimagespec.Descriptor{*s.referrer}, OciManifestReferrers); err != nil {
+		return err
+	}
+
+	referrers, err := p.getReferrers(s.repo, s.manifest.Digest, OciManifestReferrers)
+	if err != nil {
+		return err
+	}
+	return matchReferrers(referrers, []ociimagespec.Descriptor{*s.referrer})
+}
+
+func checkListReferrersFilter(p Proxy, s *conformanceState) error {
+	if s.referrer == nil {
+		return skipError("requires a pushed manifest with a subject")
+	}
+
+	supported, err := p.referrersAPISupported(s.repo, s.manifest.Digest)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return skipError("registry does not support the referrers API")
+	}
+
+	referrers, filtered, err := p.getReferrersByType(s.repo, s.manifest.Digest, OciManifestReferrers, filterArtifactTypes[1])
+	if err != nil {
+		return err
+	}
+	if !filtered {
+		return skipError("registry did not apply the artifactType filter, which is allowed")
+	}
+	return matchReferrers(referrers, nil)
+}
+
+func checkDeleteTag(p Proxy, s *conformanceState) error {
+	desc, err := p.pushOCIImage(s.repo, s.tag+"-delete")
+	if err != nil {
+		return err
+	}
+
+	regReq := registryRequest{
+		method: http.MethodDelete,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeManifest, s.repo, s.tag+"-delete")),
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code == http.StatusBadRequest || tripInfo.Response.Code == http.StatusMethodNotAllowed {
+		return skipError(fmt.Sprintf("registry does not support deleting tags: %v", tripInfo.Response.Code))
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+
+	if tripInfo, err = p.v2GetManifest(s.repo, s.tag+"-delete", desc.MediaType, anyStatusCode); err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusNotFound); err != nil {
+		return fmt.Errorf("deleted tag: %w", err)
+	}
+
+	if tripInfo, err = p.v2GetManifest(s.repo, desc.Digest.String(), desc.MediaType, anyStatusCode); err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusOK); err != nil {
+		return fmt.Errorf("manifest of deleted tag: %w", err)
+	}
+	return nil
+}
+
+func checkDeleteManifest(p Proxy, s *conformanceState) error {
+	if s.referrer == nil {
+		return skipError("requires a pushed manifest with a subject")
+	}
+
+	regReq := registryRequest{
+		method: http.MethodDelete,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeManifest, s.repo, s.referrer.Digest)),
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code == http.StatusMethodNotAllowed {
+		return skipError("registry does not support deleting manifests")
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+
+	if tripInfo, err = p.v2GetManifest(s.repo, s.referrer.Digest.String(), s.referrer.MediaType, anyStatusCode); err != nil {
+		return err
+	}
+	return expectStatus(tripInfo, http.StatusNotFound)
+}
+
+func checkDeleteBlob(p Proxy, s *conformanceState) error {
+	if s.layer == nil {
+		return skipError("requires a pushed blob")
+	}
+
+	blobURL := p.url(p.LoginServer, fmt.Sprintf(routeBlobPull, s.repo, s.layer.Digest))
+
+	tripInfo, err := p.roundTrip(registryRequest{method: http.MethodDelete, url: blobURL}, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code == http.StatusMethodNotAllowed {
+		return skipError("registry does not support deleting blobs")
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+
+	if tripInfo, err = p.roundTrip(registryRequest{method: http.MethodHead, url: blobURL}, anyStatusCode, p.auth()); err != nil {
+		return err
+	}
+	return expectStatus(tripInfo, http.StatusNotFound)
+}
+
+func checkPushInvalidManifest(p Proxy, s *conformanceState) error {
+	tripInfo, err := p.putManifest(s.repo, s.tag+"-invalid", ociimagespec.MediaTypeImageManifest, []byte("not a manifest"))
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusBadRequest, ErrorCodeManifestInvalid)
+}
+
+func checkPushMismatchedMediaType(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	tripInfo, err := p.putManifest(s.repo, s.tag+"-invalid", ociimagespec.MediaTypeImageIndex, s.manifestBytes)
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusBadRequest, ErrorCodeManifestInvalid)
+}
+
+func checkPushManifestUnknownBlob(p Proxy, s *conformanceState) error {
+	if s.config == nil {
+		return skipError("requires a pushed blob")
+	}
+
+	manifest := ociimagespec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageManifest,
+		Config:    *s.config,
+		Layers: []ociimagespec.Descriptor{
+			{
+				MediaType: checkHealthMediaType,
+				Digest:    digest.FromString(s.repo + " unknown layer"),
+				Size:      1,
+			},
+		},
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	tripInfo, err := p.putManifest(s.repo, s.tag+"-invalid", ociimagespec.MediaTypeImageManifest, manifestBytes)
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusBadRequest, ErrorCodeManifestBlobUnknown)
+}
+
+func checkPushManifestWrongDigest(p Proxy, s *conformanceState) error {
+	if s.manifest == nil {
+		return skipError("requires a pushed manifest")
+	}
+
+	tripInfo, err := p.putManifest(s.repo, digest.FromString(s.repo+" wrong digest").String(), s.manifest.MediaType, s.manifestBytes)
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusBadRequest, ErrorCodeDigestInvalid)
+}
+
+func checkUploadWrongDigest(p Proxy, s *conformanceState) error {
+	tripInfo, err := p.initiateUpload(s.repo, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err = expectStatus(tripInfo, http.StatusAccepted); err != nil {
+		return err
+	}
+	if tripInfo.HeaderLocation == nil {
+		return fmt.Errorf("missing Location header")
+	}
+
+	putURL := tripInfo.HeaderLocation
+	q := putURL.Query()
+	q.Set("digest", digest.FromString(s.repo+" wrong digest").String())
+	putURL.RawQuery = q.Encode()
+
+	regReq := registryRequest{
+		method:      http.MethodPut,
+		url:         putURL.String(),
+		body:        io.NewReader(strings.NewReader(fmt.Sprintf(checkHealthLayerFmt, time.Now()))),
+		contentType: "application/octet-stream",
+	}
+	if tripInfo, err = p.roundTrip(regReq, anyStatusCode, p.auth()); err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusBadRequest, ErrorCodeDigestInvalid)
+}
+
+func checkUnknownUpload(p Proxy, s *conformanceState) error {
+	regReq := registryRequest{
+		method:      http.MethodPatch,
+		url:         p.url(p.LoginServer, fmt.Sprintf(routeInitiateBlobUpload, s.repo)+"00000000-0000-0000-0000-000000000000"),
+		body:        io.NewReader(strings.NewReader(fmt.Sprintf(checkHealthLayerFmt, time.Now()))),
+		contentType: "application/octet-stream",
+	}
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	return expectErrorCode(tripInfo, http.StatusNotFound, ErrorCodeBlobUploadUnknown)
+}
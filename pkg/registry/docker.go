@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aviral26/acr-checkhealth/pkg/io"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Docker image media types.
+// See: https://docs.docker.com/registry/spec/manifest-v2-2/
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerConfig       = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// dockerMediaTypes describes a Docker schema2 image carrying check health test data.
+var dockerMediaTypes = imageMediaTypes{
+	name:     "Docker",
+	index:    mediaTypeDockerManifestList,
+	manifest: mediaTypeDockerManifest,
+	config:   mediaTypeDockerConfig,
+	layer:    mediaTypeDockerLayer,
+}
+
+// Suffixes of the tags of Docker content pushed alongside OCI content by checkDockerCompatibility.
+const (
+	dockerTagSuffix     = "-docker"
+	dockerListTagSuffix = "-dockerlist"
+	mismatchTagSuffix   = "-mismatch"
+)
+
+// defaultPlatform is used for single platform Docker images.
+var defaultPlatform = ociimagespec.Platform{OS: "linux", Architecture: "amd64"}
+
+// checkDockerCompatibility pushes Docker schema2 manifests and manifest lists alongside the OCI content
+// at ociTag, pulls them back, and reports how the registry negotiates and validates media types.
+func (p Proxy) checkDockerCompatibility(repo, ociTag string, ociDesc ociimagespec.Descriptor, platforms []ociimagespec.Platform) error {
+	var (
+		dockerTag     = ociTag + dockerTagSuffix
+		dockerListTag = ociTag + dockerListTagSuffix
+		mismatchTag   = ociTag + mismatchTagSuffix
+	)
+
+	// Push and pull a schema2 image
+	p.Logger.Info().Msg(fmt.Sprintf("push Docker image %v:%v", repo, dockerTag))
+	imageBytes, err := p.createPlatformImage(repo, defaultPlatform, dockerMediaTypes)
+	if err != nil {
+		return err
+	}
+	imageDesc, err := p.v2PushManifest(repo, dockerTag, dockerMediaTypes.manifest, imageBytes)
+	if err != nil {
+		return err
+	}
+	if err = p.pullOCIImage(repo, dockerTag, imageDesc); err != nil {
+		return err
+	}
+
+	// Push and pull a manifest list
+	if len(platforms) == 0 {
+		platforms = []ociimagespec.Platform{defaultPlatform}
+	}
+	listDesc, err := p.pushImageIndex(repo, dockerListTag, platforms, dockerMediaTypes, nil)
+	if err != nil {
+		return err
+	}
+	if err = p.pullImageIndex(repo, dockerListTag, listDesc, platforms); err != nil {
+		return err
+	}
+
+	// Content negotiation: each manifest must be returned as-is to a client that accepts its media type.
+	for _, c := range []struct {
+		tag  string
+		desc ociimagespec.Descriptor
+	}{
+		{ociTag, ociDesc},
+		{dockerTag, imageDesc},
+		{dockerListTag, listDesc},
+	} {
+		accept := strings.Join([]string{c.desc.MediaType, mediaTypeDockerManifest, ociimagespec.MediaTypeImageManifest}, ", ")
+		tripInfo, err := p.v2GetManifest(repo, c.tag, accept, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		if tripInfo.Response.HeaderContentType != c.desc.MediaType {
+			return fmt.Errorf("manifest content type mismatch for %v:%v; expected: %v, got: %v", repo, c.tag, c.desc.MediaType, tripInfo.Response.HeaderContentType)
+		}
+		if tripInfo.Response.SHA256Sum != c.desc.Digest {
+			return withRequest(tripInfo, integrityError("manifest digest mismatch for %v:%v; expected: %v, got: %v", repo, c.tag, c.desc.Digest, tripInfo.Response.SHA256Sum))
+		}
+	}
+
+	// Content negotiation: clients that do not accept the stored media type.
+	for _, c := range []struct {
+		tag    string
+		desc   ociimagespec.Descriptor
+		accept string
+	}{
+		{ociTag, ociDesc, mediaTypeDockerManifest},
+		{dockerTag, imageDesc, ociimagespec.MediaTypeImageManifest},
+		{dockerListTag, listDesc, mediaTypeDockerManifest},
+	} {
+		if err = p.reportNegotiation(repo, c.tag, c.desc, c.accept); err != nil {
+			return err
+		}
+	}
+
+	// Mismatched media types: a schema2 manifest uploaded with an OCI content type.
+	return p.reportMismatchedPush(repo, mismatchTag, imageBytes, ociimagespec.MediaTypeImageManifest)
+}
+
+// reportNegotiation gets the manifest at repo:tag accepting only the given media type, and logs whether the
+// registry returned the stored manifest, converted it or rejected the request.
+func (p Proxy) reportNegotiation(repo, tag string, stored ociimagespec.Descriptor, accept string) error {
+	tripInfo, err := p.v2GetManifest(repo, tag, accept, anyStatusCode)
+	if err != nil {
+		return err
+	}
+
+	var result string
+	switch {
+	case tripInfo.Response.Code != http.StatusOK:
+		result = fmt.Sprintf("rejected with %v", tripInfo.Response.Code)
+	case tripInfo.Response.SHA256Sum == stored.Digest:
+		result = fmt.Sprintf("returned stored %v", tripInfo.Response.HeaderContentType)
+	default:
+		result = fmt.Sprintf("converted to %v %v", tripInfo.Response.HeaderContentType, tripInfo.Response.SHA256Sum)
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("%v:%v (%v) accepting only %v: %v", repo, tag, stored.MediaType, accept, result))
+
+	return nil
+}
+
+// reportMismatchedPush pushes manifestBytes with a content type that does not match its mediaType field, and
+// logs whether the registry rejected the manifest or which media type it is later served as.
+func (p Proxy) reportMismatchedPush(repo, tag string, manifestBytes []byte, contentType string) error {
+	regReq := registryRequest{
+		method:      http.MethodPut,
+		url:         p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, tag)),
+		body:        io.NewReader(strings.NewReader(string(manifestBytes))),
+		contentType: contentType,
+	}
+
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code != http.StatusCreated {
+		p.Logger.Info().Msg(fmt.Sprintf("push with mismatched content type %v: rejected with %v %s", contentType, tripInfo.Response.Code, tripInfo.Response.Body))
+		return nil
+	}
+
+	accept := strings.Join([]string{mediaTypeDockerManifest, ociimagespec.MediaTypeImageManifest}, ", ")
+	tripInfo, err = p.v2GetManifest(repo, tag, accept, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push with mismatched content type %v: accepted, served as %v", contentType, tripInfo.Response.HeaderContentType))
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+)
+
+// Error codes defined by the distribution-spec.
+// See: https://github.com/opencontainers/distribution-spec/blob/main/spec.md#error-codes
+const (
+	ErrorCodeBlobUnknown         = "BLOB_UNKNOWN"
+	ErrorCodeBlobUploadInvalid   = "BLOB_UPLOAD_INVALID"
+	ErrorCodeBlobUploadUnknown   = "BLOB_UPLOAD_UNKNOWN"
+	ErrorCodeDigestInvalid       = "DIGEST_INVALID"
+	ErrorCodeManifestBlobUnknown = "MANIFEST_BLOB_UNKNOWN"
+	ErrorCodeManifestInvalid     = "MANIFEST_INVALID"
+	ErrorCodeManifestUnknown     = "MANIFEST_UNKNOWN"
+	ErrorCodeNameInvalid         = "NAME_INVALID"
+	ErrorCodeNameUnknown         = "NAME_UNKNOWN"
+	ErrorCodeSizeInvalid         = "SIZE_INVALID"
+	ErrorCodeUnauthorized        = "UNAUTHORIZED"
+	ErrorCodeDenied              = "DENIED"
+	ErrorCodeUnsupported         = "UNSUPPORTED"
+	ErrorCodeTooManyRequests     = "TOOMANYREQUESTS"
+)
+
+// ErrorDetail is a single error of a distribution-spec error response.
+type ErrorDetail struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+// RequestInfo identifies a request to the registry, so that its failure can be filed with the registry
+// operator.
+type RequestInfo struct {
+	Method        string `json:"method"`
+	URL           string `json:"url"`
+	StatusCode    int    `json:"statusCode"`
+	CorrelationID string `json:"correlationId,omitempty"`
+	RequestID     string `json:"requestId,omitempty"`
+	APIVersion    string `json:"apiVersion,omitempty"`
+}
+
+// newRequestInfo returns the info of the request of a round trip.
+func newRequestInfo(tripInfo rhttp.RoundTripInfo) RequestInfo {
+	return RequestInfo{
+		Method:        tripInfo.Request.Method,
+		URL:           rhttp.RedactURL(tripInfo.Request.URL),
+		StatusCode:    tripInfo.Response.Code,
+		CorrelationID: tripInfo.Response.HeaderCorrelationRequestID,
+		RequestID:     tripInfo.Response.HeaderRequestID,
+		APIVersion:    tripInfo.Response.HeaderAPIVersion,
+	}
+}
+
+// ids returns the correlation and request IDs of the request, if any.
+func (r RequestInfo) ids() string {
+	var ids []string
+	if r.CorrelationID != "" {
+		ids = append(ids, "correlation ID: "+r.CorrelationID)
+	}
+	if r.RequestID != "" {
+		ids = append(ids, "request ID: "+r.RequestID)
+	}
+	return strings.Join(ids, ", ")
+}
+
+// withIDs appends the correlation and request IDs of the request, if any, to msg.
+func (r RequestInfo) withIDs(msg string) string {
+	if ids := r.ids(); ids != "" {
+		return fmt.Sprintf("%v (%v)", msg, ids)
+	}
+	return msg
+}
+
+// Error is returned when a registry request gets an unexpected response code. If the response has a
+// distribution-spec error body, its errors are parsed.
+type Error struct {
+	RequestInfo
+	Expected []int         `json:"expected,omitempty"`
+	Errors   []ErrorDetail `json:"errors,omitempty"`
+
+	// Body is the response body, if it is not a distribution-spec error body.
+	Body string `json:"body,omitempty"`
+}
+
+// newError returns an Error for an unexpected response.
+func newError(tripInfo rhttp.RoundTripInfo, expected ...int) *Error {
+	e := &Error{
+		RequestInfo: newRequestInfo(tripInfo),
+		Expected:    expected,
+	}
+
+	var body struct {
+		Errors []ErrorDetail `json:"errors"`
+	}
+	if err := json.Unmarshal(tripInfo.Response.Body, &body); err == nil && len(body.Errors) > 0 {
+		e.Errors = body.Errors
+	} else {
+		e.Body = string(tripInfo.Response.Body)
+	}
+
+	return e
+}
+
+// Error returns the response code, the errors of the response body and the IDs of the request.
+func (e *Error) Error() string {
+	return e.withIDs(e.message())
+}
+
+// message returns the response code and the errors of the response body.
+func (e *Error) message() string {
+	var expected []string
+	for _, code := range e.Expected {
+		expected = append(expected, fmt.Sprint(code))
+	}
+
+	msg := fmt.Sprintf("invalid response code, expected: %v, got: %v", strings.Join(expected, " or "), e.StatusCode)
+	if len(e.Errors) == 0 {
+		if e.Body == "" {
+			return msg + ", no error body"
+		}
+		return fmt.Sprintf("%v, %v", msg, e.Body)
+	}
+
+	var details []string
+	for _, detail := range e.Errors {
+		s := detail.Code
+		if detail.Message != "" {
+			s += ": " + detail.Message
+		}
+		if len(detail.Detail) > 0 && string(detail.Detail) != "null" {
+			s += fmt.Sprintf(" (%s)", detail.Detail)
+		}
+		details = append(details, s)
+	}
+	return fmt.Sprintf("%v, %v", msg, strings.Join(details, "; "))
+}
+
+// Codes returns the error codes of the response body.
+func (e *Error) Codes() []string {
+	var codes []string
+	for _, detail := range e.Errors {
+		codes = append(codes, detail.Code)
+	}
+	return codes
+}
+
+// HasCode reports whether the response body has an error with the given code.
+func (e *Error) HasCode(code string) bool {
+	for _, detail := range e.Errors {
+		if detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// requestError is a failure of a request that got the expected response code, such as a digest mismatch of
+// the response body.
+type requestError struct {
+	RequestInfo
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.withIDs(e.err.Error())
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// withRequest returns err with the info of the request of a round trip, or nil if err is nil.
+func withRequest(tripInfo rhttp.RoundTripInfo, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &requestError{RequestInfo: newRequestInfo(tripInfo), err: err}
+}
+
+// FailedRequest returns the info of the request that caused err, if known.
+func FailedRequest(err error) (RequestInfo, bool) {
+	var registryErr *Error
+	if errors.As(err, &registryErr) {
+		return registryErr.RequestInfo, true
+	}
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.RequestInfo, true
+	}
+
+	return RequestInfo{}, false
+}
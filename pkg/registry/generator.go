@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Layer compression algorithms.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// zstd frame constants.
+// See: https://github.com/facebook/zstd/blob/dev/doc/zstd_compression_format.md
+const (
+	zstdMagic = 0xFD2FB528
+
+	// Single segment frame with an 8 byte content size and no checksum.
+	zstdFrameHeaderDescriptor = 0xE0
+
+	zstdMaxBlockSize = 128 * 1024
+	zstdLastBlock    = 1
+	zstdRawBlock     = 0 << 1
+)
+
+// ImageSpec describes the shape of a generated image.
+type ImageSpec struct {
+	// Layers is the number of layers.
+	Layers int
+
+	// LayerSize is the size in bytes of the random file in each layer, before compression.
+	LayerSize int64
+
+	// Compression is the layer compression algorithm: none, gzip or zstd.
+	Compression string
+
+	// Annotations are added to the image manifest.
+	Annotations map[string]string
+}
+
+// blob is generated content along with its descriptor.
+type blob struct {
+	ociimagespec.Descriptor
+	data []byte
+}
+
+// generatedImage is an image generated from an ImageSpec.
+type generatedImage struct {
+	config   blob
+	layers   []blob
+	manifest []byte
+}
+
+// generate creates an image for the given platform with a valid config, including rootfs diff_ids, and
+// tar layers compressed as requested.
+func (s ImageSpec) generate(platform ociimagespec.Platform) (*generatedImage, error) {
+	if s.Layers < 1 {
+		return nil, fmt.Errorf("invalid layer count: %v", s.Layers)
+	}
+	if s.LayerSize < 0 {
+		return nil, fmt.Errorf("invalid layer size: %v", s.LayerSize)
+	}
+
+	layerMediaType, err := layerMediaType(s.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		now   = time.Now().UTC()
+		image = &generatedImage{}
+		rng   = rand.New(rand.NewSource(now.UnixNano()))
+	)
+
+	config := ociimagespec.Image{
+		Created:      &now,
+		Author:       checkHealthAuthor,
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Variant:      platform.Variant,
+		Config: ociimagespec.ImageConfig{
+			Labels: map[string]string{"author": checkHealthAuthor},
+		},
+		RootFS: ociimagespec.RootFS{Type: "layers"},
+	}
+
+	for i := 0; i < s.Layers; i++ {
+		name := fmt.Sprintf("checkhealth/layer-%v", i+1)
+		tarBytes, err := tarFile(name, s.LayerSize, rng, now)
+		if err != nil {
+			return nil, err
+		}
+
+		layerBytes, err := compress(tarBytes, s.Compression)
+		if err != nil {
+			return nil, err
+		}
+
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, digest.FromBytes(tarBytes))
+		config.History = append(config.History, ociimagespec.History{
+			Created:   &now,
+			CreatedBy: fmt.Sprintf("%v: add %v (%v bytes)", checkHealthAuthor, name, s.LayerSize),
+		})
+		image.layers = append(image.layers, newBlob(layerMediaType, layerBytes))
+	}
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	image.config = newBlob(ociimagespec.MediaTypeImageConfig, configBytes)
+
+	manifest := ociimagespec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ociimagespec.MediaTypeImageManifest,
+		Config:      image.config.Descriptor,
+		Annotations: s.Annotations,
+	}
+	for _, layer := range image.layers {
+		manifest.Layers = append(manifest.Layers, layer.Descriptor)
+	}
+
+	image.manifest, err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// pushGeneratedImage generates an image from spec for the given platform and pushes it to repo with the
+// given tag or digest reference. An empty reference pushes the manifest by digest.
+func (p Proxy) pushGeneratedImage(repo, reference string, spec ImageSpec, platform ociimagespec.Platform) (_ ociimagespec.Descriptor, err error) {
+	p, span := p.startSpan("push image", "oci.repository", repo, "oci.reference", reference)
+	defer func() { span.End(err) }()
+
+	image, err := spec.generate(platform)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	if reference == "" {
+		reference = digest.FromBytes(image.manifest).String()
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push generated image %v:%v for %v with %v %v layers of %v bytes",
+		repo, reference, platformString(platform), spec.Layers, spec.Compression, spec.LayerSize))
+
+	for _, b := range append([]blob{image.config}, image.layers...) {
+		desc, err := p.v2PushBlob(repo, io.NewReader(bytes.NewReader(b.data)))
+		if err != nil {
+			return ociimagespec.Descriptor{}, err
+		}
+		if desc.Digest != b.Digest || desc.Size != b.Size {
+			return ociimagespec.Descriptor{}, integrityError("blob upload mismatch; expected: %v (%v bytes), got: %v (%v bytes)", b.Digest, b.Size, desc.Digest, desc.Size)
+		}
+	}
+
+	return p.v2PushManifest(repo, reference, ociimagespec.MediaTypeImageManifest, image.manifest)
+}
+
+// newBlob creates a blob with the given media type and data.
+func newBlob(mediaType string, data []byte) blob {
+	return blob{
+		Descriptor: ociimagespec.Descriptor{
+			MediaType: mediaType,
+			Digest:    digest.FromBytes(data),
+			Size:      int64(len(data)),
+		},
+		data: data,
+	}
+}
+
+// layerMediaType returns the OCI layer media type for the given compression.
+func layerMediaType(compression string) (string, error) {
+	switch strings.ToLower(compression) {
+	case CompressionNone:
+		return ociimagespec.MediaTypeImageLayer, nil
+	case CompressionGzip, "":
+		return ociimagespec.MediaTypeImageLayerGzip, nil
+	case CompressionZstd:
+		return ociimagespec.MediaTypeImageLayerZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported compression: %v", compression)
+	}
+}
+
+// tarFile creates a tar archive with a single file of the given size filled with random bytes.
+func tarFile(name string, size int64, rng *rand.Rand, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	}); err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, size)
+	rng.Read(content)
+	if _, err := tw.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compress compresses data with the given algorithm.
+func compress(data []byte, compression string) ([]byte, error) {
+	switch strings.ToLower(compression) {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip, "":
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return zstdFrame(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", compression)
+	}
+}
+
+// zstdFrame encodes data as a zstd frame. The standard library has no zstd encoder, so the frame is made
+// of raw blocks: it is valid zstd that any decoder accepts, but it is not smaller than the input. Layers
+// are filled with random bytes, which do not compress anyway.
+func zstdFrame(data []byte) []byte {
+	var buf bytes.Buffer
+
+	header := make([]byte, 13)
+	binary.LittleEndian.PutUint32(header[0:], zstdMagic)
+	header[4] = zstdFrameHeaderDescriptor
+	binary.LittleEndian.PutUint64(header[5:], uint64(len(data)))
+	buf.Write(header)
+
+	for {
+		n := len(data)
+		if n > zstdMaxBlockSize {
+			n = zstdMaxBlockSize
+		}
+
+		blockHeader := uint32(n)<<3 | zstdRawBlock
+		if n == len(data) {
+			blockHeader |= zstdLastBlock
+		}
+		buf.Write([]byte{byte(blockHeader), byte(blockHeader >> 8), byte(blockHeader >> 16)})
+		buf.Write(data[:n])
+
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestZstdFrame(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, size := range []int{0, 1, zstdMaxBlockSize - 1, zstdMaxBlockSize, zstdMaxBlockSize + 1, 3*zstdMaxBlockSize + 42} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			data := make([]byte, size)
+			rng.Read(data)
+
+			got, err := decodeRawZstdFrame(zstdFrame(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("decoded %v bytes, want the %v input bytes", len(got), len(data))
+			}
+		})
+	}
+}
+
+// decodeRawZstdFrame decodes a zstd frame of raw blocks, as written by zstdFrame. There is no zstd decoder
+// in the standard library.
+func decodeRawZstdFrame(frame []byte) ([]byte, error) {
+	if len(frame) < 13 {
+		return nil, fmt.Errorf("frame of %v bytes is shorter than its header", len(frame))
+	}
+	if magic := binary.LittleEndian.Uint32(frame); magic != zstdMagic {
+		return nil, fmt.Errorf("magic number %#x, want %#x", magic, zstdMagic)
+	}
+	if frame[4] != zstdFrameHeaderDescriptor {
+		return nil, fmt.Errorf("frame header descriptor %#x, want %#x", frame[4], zstdFrameHeaderDescriptor)
+	}
+	contentSize := binary.LittleEndian.Uint64(frame[5:])
+	frame = frame[13:]
+
+	var data []byte
+	for {
+		if len(frame) < 3 {
+			return nil, fmt.Errorf("truncated block header")
+		}
+		blockHeader := uint32(frame[0]) | uint32(frame[1])<<8 | uint32(frame[2])<<16
+		frame = frame[3:]
+
+		if blockType := blockHeader >> 1 & 3; blockType != zstdRawBlock {
+			return nil, fmt.Errorf("block type %v, want a raw block", blockType)
+		}
+		n := int(blockHeader >> 3)
+		if n > zstdMaxBlockSize || n > len(frame) {
+			return nil, fmt.Errorf("invalid block size %v", n)
+		}
+		data = append(data, frame[:n]...)
+		frame = frame[n:]
+
+		if blockHeader&zstdLastBlock != 0 {
+			break
+		}
+	}
+
+	if len(frame) != 0 {
+		return nil, fmt.Errorf("%v trailing bytes after the last block", len(frame))
+	}
+	if uint64(len(data)) != contentSize {
+		return nil, fmt.Errorf("content size %v, decoded %v bytes", contentSize, len(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/aviral26/acr-checkhealth/pkg/layout"
+	"github.com/opencontainers/go-digest"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParseReference splits an image reference such as hello-world:latest or hello-world@sha256:... into
+// the repository name and the tag or digest.
+func ParseReference(reference string) (repo, tagOrDigest string, err error) {
+	if i := strings.Index(reference, "@"); i >= 0 {
+		dgst, err := digest.Parse(reference[i+1:])
+		if err != nil {
+			return "", "", err
+		}
+		repo, tagOrDigest = reference[:i], dgst.String()
+	} else if i := strings.LastIndex(reference, ":"); i >= 0 && !strings.Contains(reference[i:], "/") {
+		repo, tagOrDigest = reference[:i], reference[i+1:]
+	}
+
+	if repo == "" || tagOrDigest == "" {
+		return "", "", fmt.Errorf("invalid image reference %q, expected <repo>:<tag> or <repo>@<digest>", reference)
+	}
+
+	return repo, tagOrDigest, nil
+}
+
+// manifestMediaTypes are the manifest media types accepted when the media type of a manifest is unknown.
+var manifestMediaTypes = []string{
+	ociimagespec.MediaTypeImageIndex,
+	ociimagespec.MediaTypeImageManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeDockerManifest,
+	ociimagespec.MediaTypeArtifactManifest,
+}
+
+// manifestContent lists the blobs and metadata of an image or artifact manifest.
+type manifestContent struct {
+	ArtifactType string                    `json:"artifactType,omitempty"`
+	Config       *ociimagespec.Descriptor  `json:"config,omitempty"`
+	Layers       []ociimagespec.Descriptor `json:"layers,omitempty"`
+	Blobs        []ociimagespec.Descriptor `json:"blobs,omitempty"`
+	Annotations  map[string]string         `json:"annotations,omitempty"`
+}
+
+// artifactType returns the artifact type of the manifest, which is the config media type for image manifests
+// without an artifactType.
+func (m manifestContent) artifactType() string {
+	if m.ArtifactType == "" && m.Config != nil {
+		return m.Config.MediaType
+	}
+	return m.ArtifactType
+}
+
+// blobs returns the config, layers and blobs of the manifest.
+func (m manifestContent) blobs() []ociimagespec.Descriptor {
+	var blobs []ociimagespec.Descriptor
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	blobs = append(blobs, m.Layers...)
+	return append(blobs, m.Blobs...)
+}
+
+// isIndex reports whether the media type is an image index or manifest list.
+func isIndex(mediaType string) bool {
+	return mediaType == ociimagespec.MediaTypeImageIndex || mediaType == mediaTypeDockerManifestList
+}
+
+// PushImage pushes a local image to repo with the given tag, then pulls it back and verifies the digest and
+// size of every manifest and blob. If repo is empty, the image is pushed to a new repository.
+func (p Proxy) PushImage(image *layout.Image, repo, tag string) error {
+	if repo == "" {
+		repo = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		tag = fmt.Sprintf("%v", time.Now().Unix())
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push image %v to %v:%v", image.Root.Digest, repo, tag))
+
+	push, span := p.startSpan("push image", "oci.repository", repo, "oci.reference", tag)
+	err := push.pushImageTree(image, repo, tag, image.Root, make(map[digest.Digest]bool))
+	span.End(err)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("pull image %v:%v", repo, tag))
+
+	pull, span := p.startSpan("pull image", "oci.repository", repo, "oci.reference", tag)
+	err = pull.pullImageTree(repo, tag, image.Root, nil)
+	span.End(err)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg("push-image was successful")
+
+	return nil
+}
+
+// pushImageTree pushes the manifest or index described by desc with the given tag or digest reference,
+// after pushing everything it references. Content already in pushed is skipped.
+func (p Proxy) pushImageTree(image *layout.Image, repo, reference string, desc ociimagespec.Descriptor, pushed map[digest.Digest]bool) error {
+	manifestBytes, err := image.ReadBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+
+	if isIndex(desc.MediaType) {
+		var index ociimagespec.Index
+		if err = json.Unmarshal(manifestBytes, &index); err != nil {
+			return err
+		}
+
+		for _, child := range index.Manifests {
+			if err = p.pushImageTree(image, repo, child.Digest.String(), child, pushed); err != nil {
+				return err
+			}
+		}
+	} else {
+		var manifest manifestContent
+		if err = json.Unmarshal(manifestBytes, &manifest); err != nil {
+			return err
+		}
+
+		for _, blob := range manifest.blobs() {
+			if pushed[blob.Digest] {
+				continue
+			}
+			if err = p.pushImageBlob(image, repo, blob); err != nil {
+				return err
+			}
+			pushed[blob.Digest] = true
+		}
+	}
+
+	if pushed[desc.Digest] && reference == desc.Digest.String() {
+		return nil
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push manifest %v:%v", repo, reference))
+
+	pushedDesc, err := p.v2PushManifest(repo, reference, desc.MediaType, manifestBytes)
+	if err != nil {
+		return err
+	}
+	if pushedDesc.Digest != desc.Digest {
+		return integrityError("manifest digest mismatch; expected: %v, got: %v", desc.Digest, pushedDesc.Digest)
+	}
+	pushed[desc.Digest] = true
+
+	return nil
+}
+
+// pushImageBlob uploads a blob of a local image and verifies the uploaded digest and size.
+func (p Proxy) pushImageBlob(image *layout.Image, repo string, desc ociimagespec.Descriptor) error {
+	rc, err := image.Blob(desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	p.Logger.Info().Msg(fmt.Sprintf("push blob %v (%v bytes)", desc.Digest, desc.Size))
+
+	pushedDesc, err := p.v2PushBlob(repo, io.NewReader(rc))
+	if err != nil {
+		return err
+	}
+	if pushedDesc.Digest != desc.Digest {
+		return integrityError("blob digest mismatch; expected: %v, got: %v", desc.Digest, pushedDesc.Digest)
+	}
+	if pushedDesc.Size != desc.Size {
+		return integrityError("blob size mismatch; expected: %v, got: %v", desc.Size, pushedDesc.Size)
+	}
+
+	return nil
+}
+
+// PullImage pulls the image at repo:reference, where reference is a tag or digest, along with everything it
+// references, verifies every digest and writes the content to the OCI image layout w.
+func (p Proxy) PullImage(repo, reference string, w *layout.Writer) error {
+	p.Logger.Info().Msg(fmt.Sprintf("resolve %v:%v", repo, reference))
+
+	tripInfo, err := p.v2GetManifest(repo, reference, strings.Join(manifestMediaTypes, ", "), http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	root := ociimagespec.Descriptor{
+		MediaType: tripInfo.Response.HeaderContentType,
+		Digest:    tripInfo.Response.SHA256Sum,
+		Size:      tripInfo.Response.Size,
+	}
+	if root.MediaType == "" {
+		var manifest struct {
+			MediaType string `json:"mediaType"`
+		}
+		if err = json.Unmarshal(tripInfo.Body, &manifest); err != nil {
+			return err
+		}
+		root.MediaType = manifest.MediaType
+	}
+
+	name := fmt.Sprintf("%v:%v", repo, reference)
+	if dgst, err := digest.Parse(reference); err == nil {
+		if dgst != root.Digest {
+			return integrityError("manifest digest mismatch; expected: %v, got: %v", dgst, root.Digest)
+		}
+		name = fmt.Sprintf("%v@%v", repo, reference)
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("pull image %v@%v (%v)", repo, root.Digest, root.MediaType))
+
+	err = p.pullImageTree(repo, root.Digest.String(), root, w.WriteBlob)
+	if err != nil {
+		return err
+	}
+
+	if err = w.Tag(root, name); err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg("pull-image was successful")
+
+	return nil
+}
+
+// pullImageTree pulls the manifest or index described by desc from repo by tag or digest, and everything
+// it references, verifying the digest and size of each. If visit is set, it is called with the content of
+// each manifest and blob.
+func (p Proxy) pullImageTree(repo, reference string, desc ociimagespec.Descriptor, visit func(ociimagespec.Descriptor, []byte) error) error {
+	manifestBytes, err := p.v2PullManifest(repo, reference, desc)
+	if err != nil {
+		return err
+	}
+
+	if visit != nil {
+		if err = visit(desc, manifestBytes); err != nil {
+			return err
+		}
+	}
+
+	if isIndex(desc.MediaType) {
+		var index ociimagespec.Index
+		if err = json.Unmarshal(manifestBytes, &index); err != nil {
+			return err
+		}
+
+		for _, child := range index.Manifests {
+			if err = p.pullImageTree(repo, child.Digest.String(), child, visit); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var manifest manifestContent
+	if err = json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return err
+	}
+
+	for _, blob := range manifest.blobs() {
+		p.Logger.Info().Msg(fmt.Sprintf("pull blob %v (%v bytes)", blob.Digest, blob.Size))
+
+		data, err := p.v2FetchBlob(repo, blob)
+		if err != nil {
+			return err
+		}
+
+		if visit != nil {
+			if err = visit(blob, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
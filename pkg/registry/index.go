@@ -0,0 +1,321 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// HealthOptions configures the health check.
+type HealthOptions struct {
+	// Platforms, when set, pushes an image index referencing an image per platform instead of a single image.
+	Platforms []ociimagespec.Platform
+
+	// Image, when set, generates images of the given shape instead of the default synthetic image.
+	Image *ImageSpec
+
+	// Docker additionally pushes Docker schema2 manifests and manifest lists, and reports how the registry
+	// negotiates and validates Docker and OCI media types.
+	Docker bool
+
+	// Repository, when set, is the repository pushed to under a fixed tag instead of a new repository per run,
+	// so that repeated runs do not leave a repository behind each time. The manifests pushed are deleted when
+	// the run is done.
+	Repository string
+}
+
+// imageMediaTypes is the set of media types used to build an image or image index.
+type imageMediaTypes struct {
+	// name is a friendly name used in logs.
+	name     string
+	index    string
+	manifest string
+	config   string
+	layer    string
+}
+
+// ociMediaTypes describes an OCI image carrying check health test data.
+var ociMediaTypes = imageMediaTypes{
+	name:     "OCI",
+	index:    ociimagespec.MediaTypeImageIndex,
+	manifest: ociimagespec.MediaTypeImageManifest,
+	config:   checkHealthMediaType,
+	layer:    checkHealthMediaType,
+}
+
+// ParsePlatform parses a platform specifier such as linux/amd64 or linux/arm64/v8.
+func ParsePlatform(specifier string) (ociimagespec.Platform, error) {
+	parts := strings.Split(specifier, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return ociimagespec.Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", specifier)
+	}
+
+	platform := ociimagespec.Platform{
+		OS:           parts[0],
+		Architecture: parts[1],
+	}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+
+	return platform, nil
+}
+
+// platformString formats a platform as os/arch[/variant].
+func platformString(platform ociimagespec.Platform) string {
+	s := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		s += "/" + platform.Variant
+	}
+	return s
+}
+
+// checkHealthIndex pushes a multi-platform image index, pulls it back and verifies every child image as
+// well as Accept based content negotiation.
+func (p Proxy) checkHealthIndex(repo, tag string, platforms []ociimagespec.Platform, spec *ImageSpec) (ociimagespec.Descriptor, error) {
+	// Push image index
+	indexDesc, err := p.pushImageIndex(repo, tag, platforms, ociMediaTypes, spec)
+	if err != nil {
+		return indexDesc, err
+	}
+
+	// Pull image index
+	if err = p.pullImageIndex(repo, tag, indexDesc, platforms); err != nil {
+		return indexDesc, err
+	}
+
+	// Content negotiation
+	return indexDesc, p.verifyIndexNegotiation(repo, tag, indexDesc)
+}
+
+// pushImageIndex pushes an image per platform by digest, followed by an image index referencing them.
+// If spec is set, OCI images of that shape are generated instead of simple images of the given media types.
+func (p Proxy) pushImageIndex(repo, tag string, platforms []ociimagespec.Platform, mediaTypes imageMediaTypes, spec *ImageSpec) (_ ociimagespec.Descriptor, err error) {
+	p, span := p.startSpan("push image index", "oci.repository", repo, "oci.reference", tag)
+	defer func() { span.End(err) }()
+
+	index := ociimagespec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: mediaTypes.index,
+	}
+
+	for _, platform := range platforms {
+		var (
+			desc ociimagespec.Descriptor
+			err  error
+		)
+		if spec != nil {
+			desc, err = p.pushGeneratedImage(repo, "", *spec, platform)
+		} else {
+			desc, err = p.pushPlatformImage(repo, platform, mediaTypes)
+		}
+		if err != nil {
+			return ociimagespec.Descriptor{}, err
+		}
+
+		platform := platform
+		desc.Platform = &platform
+		index.Manifests = append(index.Manifests, desc)
+	}
+
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push %v image index %v:%v", mediaTypes.name, repo, tag))
+
+	return p.v2PushManifest(repo, tag, mediaTypes.index, indexBytes)
+}
+
+// pushPlatformImage pushes a simple image for the given platform by digest.
+func (p Proxy) pushPlatformImage(repo string, platform ociimagespec.Platform, mediaTypes imageMediaTypes) (ociimagespec.Descriptor, error) {
+	manifestBytes, err := p.createPlatformImage(repo, platform, mediaTypes)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	dgst := digest.FromBytes(manifestBytes)
+	p.Logger.Info().Msg(fmt.Sprintf("push %v image %v@%v for %v", mediaTypes.name, repo, dgst, platformString(platform)))
+
+	// Push manifest by digest
+	return p.v2PushManifest(repo, dgst.String(), mediaTypes.manifest, manifestBytes)
+}
+
+// createPlatformImage uploads the blobs of a simple image for the given platform and returns its manifest.
+func (p Proxy) createPlatformImage(repo string, platform ociimagespec.Platform, mediaTypes imageMediaTypes) ([]byte, error) {
+	config := ociConfig
+	config.OS = platform.OS
+	config.Architecture = platform.Architecture
+	config.Variant = platform.Variant
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upload config blob
+	configDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(string(configBytes))))
+	if err != nil {
+		return nil, err
+	}
+
+	// Upload a layer
+	layerDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(fmt.Sprintf(checkHealthLayerFmt+" for %s", time.Now(), platformString(platform)))))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := ociimagespec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: mediaTypes.manifest,
+		Config: ociimagespec.Descriptor{
+			MediaType: mediaTypes.config,
+			Digest:    configDesc.Digest,
+			Size:      configDesc.Size,
+		},
+		Layers: []ociimagespec.Descriptor{
+			{
+				MediaType: mediaTypes.layer,
+				Digest:    layerDesc.Digest,
+				Size:      layerDesc.Size,
+			},
+		},
+	}
+
+	return json.Marshal(manifest)
+}
+
+// pullImageIndex pulls the image index from repo by tag, validates it against the given descriptor and
+// verifies that each expected platform resolves to a pullable image.
+func (p Proxy) pullImageIndex(repo, tag string, desc ociimagespec.Descriptor, platforms []ociimagespec.Platform) (err error) {
+	p, span := p.startSpan("pull image index", "oci.repository", repo, "oci.reference", tag)
+	defer func() { span.End(err) }()
+
+	p.Logger.Info().Msg(fmt.Sprintf("pull image index %v:%v", repo, tag))
+
+	pulledIndexBytes, err := p.v2PullManifest(repo, tag, desc)
+	if err != nil {
+		return err
+	}
+
+	pulledIndex := &ociimagespec.Index{}
+	if err = json.Unmarshal(pulledIndexBytes, pulledIndex); err != nil {
+		return err
+	}
+
+	if len(pulledIndex.Manifests) != len(platforms) {
+		return fmt.Errorf("unexpected index manifests count, expected: %v, got: %v", len(platforms), len(pulledIndex.Manifests))
+	}
+
+	for i, child := range pulledIndex.Manifests {
+		if child.Platform == nil || platformString(*child.Platform) != platformString(platforms[i]) {
+			return fmt.Errorf("index manifest %v platform mismatch; expected: %v", child.Digest, platformString(platforms[i]))
+		}
+
+		// Pull child image by digest
+		if err = p.pullOCIImage(repo, child.Digest.String(), child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyIndexNegotiation verifies that the registry returns the image index when the client accepts it,
+// and logs what is returned to a client that only accepts image manifests.
+func (p Proxy) verifyIndexNegotiation(repo, tag string, desc ociimagespec.Descriptor) error {
+	p.Logger.Info().Msg(fmt.Sprintf("verify content negotiation for %v:%v", repo, tag))
+
+	accept := strings.Join([]string{ociimagespec.MediaTypeImageManifest, ociimagespec.MediaTypeImageIndex}, ", ")
+	tripInfo, err := p.v2GetManifest(repo, tag, accept, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.HeaderContentType != ociimagespec.MediaTypeImageIndex {
+		return fmt.Errorf("manifest content type mismatch; expected: %v, got: %v", ociimagespec.MediaTypeImageIndex, tripInfo.Response.HeaderContentType)
+	}
+	if tripInfo.Response.SHA256Sum != desc.Digest {
+		return withRequest(tripInfo, integrityError("manifest digest mismatch; expected: %v, got: %v", desc.Digest, tripInfo.Response.SHA256Sum))
+	}
+
+	// The distribution spec does not mandate a behavior here; registries may return the index or 404.
+	tripInfo, err = p.v2GetManifest(repo, tag, ociimagespec.MediaTypeImageManifest, anyStatusCode)
+	if err != nil {
+		return err
+	}
+	p.Logger.Info().Msg(fmt.Sprintf("client accepting only %v got: %v %v", ociimagespec.MediaTypeImageManifest, tripInfo.Response.Code, tripInfo.Response.HeaderContentType))
+
+	return nil
+}
+
+// deleteImages deletes the manifests tagged with tags in repo, and the child manifests of image indexes, so
+// that pushing to the same tags on every run does not leave untagged manifests behind. Tags that do not exist
+// are skipped.
+func (p Proxy) deleteImages(repo string, tags []string) error {
+	accept := strings.Join([]string{ociimagespec.MediaTypeImageIndex, ociimagespec.MediaTypeImageManifest,
+		mediaTypeDockerManifestList, mediaTypeDockerManifest}, ", ")
+
+	// Tags may share a manifest, which can only be deleted once.
+	deleted := map[digest.Digest]bool{}
+	deleteManifest := func(dgst digest.Digest) error {
+		if deleted[dgst] {
+			return nil
+		}
+		deleted[dgst] = true
+		return p.v2DeleteManifest(repo, dgst.String())
+	}
+
+	for _, tag := range tags {
+		tripInfo, err := p.v2GetManifest(repo, tag, accept, anyStatusCode)
+		if err != nil {
+			return err
+		}
+
+		switch tripInfo.Response.Code {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			continue
+		default:
+			return newError(tripInfo, http.StatusOK, http.StatusNotFound)
+		}
+
+		// The index is deleted before its children, which some registries do not delete while referenced.
+		var index ociimagespec.Index
+		if mediaType := tripInfo.Response.HeaderContentType; mediaType == ociimagespec.MediaTypeImageIndex || mediaType == mediaTypeDockerManifestList {
+			if err = json.Unmarshal(tripInfo.Response.Body, &index); err != nil {
+				return err
+			}
+		}
+
+		if err = deleteManifest(tripInfo.Response.SHA256Sum); err != nil {
+			return err
+		}
+		for _, child := range index.Manifests {
+			if err = deleteManifest(child.Digest); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// v2GetManifest gets a manifest from repo specified by tag or digest with the given Accept header.
+func (p Proxy) v2GetManifest(repo, tagOrDigest, accept string, expected int) (rhttp.RoundTripInfo, error) {
+	regReq := registryRequest{
+		method: http.MethodGet,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, tagOrDigest)),
+		accept: accept,
+	}
+
+	return p.roundTrip(regReq, expected, p.auth())
+}
@@ -0,0 +1,42 @@
+package registry
+
+import (
+	"testing"
+
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		specifier string
+		want      ociimagespec.Platform
+		wantErr   bool
+	}{
+		{specifier: "linux/amd64", want: ociimagespec.Platform{OS: "linux", Architecture: "amd64"}},
+		{specifier: "linux/arm64/v8", want: ociimagespec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{specifier: "windows/amd64", want: ociimagespec.Platform{OS: "windows", Architecture: "amd64"}},
+		{specifier: "", wantErr: true},
+		{specifier: "linux", wantErr: true},
+		{specifier: "linux/", wantErr: true},
+		{specifier: "/amd64", wantErr: true},
+		{specifier: "linux/arm/v7/extra", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.specifier, func(t *testing.T) {
+			got, err := ParsePlatform(tt.specifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlatform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.OS != tt.want.OS || got.Architecture != tt.want.Architecture || got.Variant != tt.want.Variant {
+				t.Errorf("ParsePlatform() = %+v, want %+v", got, tt.want)
+			}
+			if s := platformString(got); s != tt.specifier {
+				t.Errorf("platformString() = %v, want %v", s, tt.specifier)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -13,6 +14,7 @@ import (
 
 	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
 	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go"
 	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
@@ -52,8 +54,12 @@ const (
 	checkHealthArtifactType = "application/acr.checkhealth.artifact.test"
 	checkHealthLayerFmt     = "Test layer authored by " + checkHealthAuthor + " at %s" // add time
 	checkHealthRepoPrefix   = "acrcheckhealth"
+	checkHealthTag          = "acrcheckhealth" // tag pushed to in HealthOptions.Repository
 )
 
+// anyStatusCode can be used as the expected response code to accept any response.
+const anyStatusCode = 0
+
 // Other data.
 var (
 	ociConfig = ociimagespec.Image{
@@ -94,6 +100,9 @@ type Proxy struct {
 	rhttp.RoundTripper
 	*Options
 	zerolog.Logger
+
+	// Span, if set, is the parent of the spans of steps and round trips made by the proxy.
+	Span *tracing.Span
 }
 
 // NewProxy creates a new registry proxy.
@@ -126,6 +135,14 @@ func (p Proxy) Ping() (err error) {
 	}
 
 	if _, err = p.roundTrip(regReq, http.StatusUnauthorized, noAuth); err != nil {
+		// Anything but a challenge is an auth configuration problem, unless the server could not handle the
+		// request at all.
+		var registryErr *Error
+		if errors.As(err, &registryErr) {
+			if _, ok := serverCategory(registryErr.StatusCode); !ok {
+				return withCategory(ErrorCategoryAuthChallenge, err)
+			}
+		}
 		return err
 	}
 
@@ -149,7 +166,7 @@ func (p Proxy) Ping() (err error) {
 		}
 
 		if _, err := p.roundTrip(regReq, http.StatusForbidden, noAuth); err != nil {
-			return err
+			return withCategory(ErrorCategoryDataEndpoint, err)
 		}
 	}
 
@@ -159,22 +176,57 @@ func (p Proxy) Ping() (err error) {
 }
 
 // CheckHealth checks the health of core registry APIs.
-func (p Proxy) CheckHealth() error {
+func (p Proxy) CheckHealth(opts HealthOptions) (err error) {
 	var (
 		repo = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
 		tag  = fmt.Sprintf("%v", time.Now().Unix())
 	)
+	if opts.Repository != "" {
+		repo, tag = opts.Repository, checkHealthTag
 
-	// Push simple image
-	desc, err := p.pushOCIImage(repo, tag)
-	if err != nil {
-		return err
+		// Every run pushes new content to the same tags, so delete it once done, even if the run failed.
+		tags := []string{tag}
+		if opts.Docker {
+			tags = append(tags, tag+dockerTagSuffix, tag+dockerListTagSuffix, tag+mismatchTagSuffix)
+		}
+		defer func() {
+			if deleteErr := p.deleteImages(repo, tags); err == nil {
+				err = deleteErr
+			}
+		}()
 	}
 
-	// Pull image
-	err = p.pullOCIImage(repo, tag, desc)
-	if err != nil {
-		return err
+	var desc ociimagespec.Descriptor
+
+	if len(opts.Platforms) > 0 {
+		// Push and pull image index
+		desc, err = p.checkHealthIndex(repo, tag, opts.Platforms, opts.Image)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Push simple or generated image
+		if opts.Image != nil {
+			desc, err = p.pushGeneratedImage(repo, tag, *opts.Image, defaultPlatform)
+		} else {
+			desc, err = p.pushOCIImage(repo, tag)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Pull image
+		err = p.pullOCIImage(repo, tag, desc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Docker {
+		err = p.checkDockerCompatibility(repo, tag, desc, opts.Platforms)
+		if err != nil {
+			return err
+		}
 	}
 
 	p.Logger.Info().Msg("check-health was successful")
@@ -201,6 +253,10 @@ func (p Proxy) CheckReferrers(count int, referrersVersion string) error {
 	}
 
 	// Discover and verify referrers
+	err = p.waitForReferrers(repo, imageDesc.Digest, pushedReferrers, referrersVersion)
+	if err != nil {
+		return err
+	}
 	err = p.verifyReferrers(repo, imageDesc, pushedReferrers, referrersVersion)
 	if err != nil {
 		return err
@@ -248,6 +304,10 @@ func (p Proxy) CheckReferrersOutOfOrder(count int, referrersVersion string) erro
 	p.v2PushManifest(repo, imageTag, ociimagespec.MediaTypeImageManifest, data)
 
 	// Discover and verify referrers
+	err = p.waitForReferrers(repo, imageDesc.Digest, pushedReferrers, referrersVersion)
+	if err != nil {
+		return err
+	}
 	err = p.verifyReferrers(repo, imageDesc, pushedReferrers, referrersVersion)
 	if err != nil {
 		return err
@@ -294,14 +354,6 @@ func (p Proxy) pushReferrers(repo string, subject ociimagespec.Descriptor, count
 	var referrers []ociimagespec.Descriptor
 
 	for i := 0; i < count; i++ {
-		time.Sleep(time.Second * 4)
-		// Push artifact layer
-		layerDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(fmt.Sprintf(checkHealthLayerFmt+"  ~ %v", time.Now(), i))))
-		if err != nil {
-			return nil, err
-		}
-		mediaType := ""
-		var artifactBytes []byte
 		var annotations map[string]string
 		if i%2 == 0 {
 			now := time.Now().Format(time.RFC3339)
@@ -311,58 +363,112 @@ func (p Proxy) pushReferrers(repo string, subject ociimagespec.Descriptor, count
 			}
 		}
 
-		if referrersVersion == OciReferrers {
-			artifactBytes, err = p.createOCIArtifactReferrer(annotations, subject, layerDesc)
-			mediaType = ociimagespec.MediaTypeArtifactManifest
+		artifactTag := fmt.Sprintf("art-%v-%v", i+1, time.Now().Unix())
+		p.Logger.Info().Msg(fmt.Sprintf("push OCI artifact %v:%v, createdTime %t", repo, artifactTag, i%2 == 0))
+
+		referrer, err := p.pushReferrer(repo, artifactTag, subject, referrersVersion, "", annotations)
+		if err != nil {
+			return nil, err
 		}
 
-		if referrersVersion == OciManifestReferrers {
+		referrers = append(referrers, referrer)
+	}
 
-			configBytes, err := json.Marshal(ociConfig)
-			if err != nil {
-				return nil, err
-			}
+	return referrers, nil
+}
 
-			// Upload config blob
-			configDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(string(configBytes))))
-			if err != nil {
-				return nil, err
-			}
+// pushReferrer pushes an artifact of the given artifact type that refers to subject, using the manifest
+// type of the referrers API version, and returns the descriptor expected from the referrers API. An empty
+// tag pushes the artifact by digest, and an empty artifact type uses the default test artifact type.
+func (p Proxy) pushReferrer(repo, tag string, subject ociimagespec.Descriptor, referrersVersion, artifactType string, annotations map[string]string) (_ ociimagespec.Descriptor, err error) {
+	p, span := p.startSpan("push referrer", "oci.repository", repo, "oci.subject", subject.Digest.String())
+	defer func() { span.End(err) }()
 
-			artifactBytes, err = p.createOCIManifestReferrer(annotations, subject, layerDesc, configDesc)
-			mediaType = ociimagespec.MediaTypeImageManifest
+	// Push artifact layer
+	layerDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(fmt.Sprintf(checkHealthLayerFmt+"  ~ %v", time.Now(), tag))))
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	var (
+		mediaType     string
+		artifactBytes []byte
+	)
+
+	switch referrersVersion {
+	case OciReferrers:
+		if artifactType == "" {
+			artifactType = checkHealthArtifactType
 		}
+		artifactBytes, err = p.createOCIArtifactReferrer(annotations, subject, layerDesc, artifactType)
+		mediaType = ociimagespec.MediaTypeArtifactManifest
 
-		if referrersVersion == OrasReferrers {
-			var annotations map[string]string
-			artifactBytes, err = p.createORASArtifactReferrer(annotations, subject, layerDesc)
-			mediaType = orasartifact.MediaTypeArtifactManifest
+	case OciManifestReferrers:
+		// Image manifests have no artifactType, the referrers API reports their config media type instead.
+		if artifactType == "" {
+			artifactType = checkHealthMediaType
 		}
 
+		configBytes, err := json.Marshal(ociConfig)
 		if err != nil {
-			return nil, err
+			return ociimagespec.Descriptor{}, err
 		}
 
-		artifactTag := fmt.Sprintf("art-%v-%v", i+1, time.Now().Unix())
-		p.Logger.Info().Msg(fmt.Sprintf("push OCI artifact %v:%v, createdTime %t", repo, artifactTag, i%2 == 0))
-
-		// Push artifact
-		artifactDesc, err := p.v2PushManifest(repo, artifactTag, mediaType, artifactBytes)
+		// Upload config blob
+		configDesc, err := p.v2PushBlob(repo, io.NewReader(strings.NewReader(string(configBytes))))
 		if err != nil {
-			return nil, err
+			return ociimagespec.Descriptor{}, err
 		}
+		configDesc.MediaType = artifactType
 
-		referrers = append(referrers, ociimagespec.Descriptor{
-			MediaType:    artifactDesc.MediaType,
-			Digest:       artifactDesc.Digest,
-			Size:         artifactDesc.Size,
-			ArtifactType: checkHealthArtifactType}) // Data: base64.StdEncoding.EncodeToString(artifactBytes)})
+		artifactBytes, err = p.createOCIManifestReferrer(annotations, subject, layerDesc, configDesc)
+		mediaType = ociimagespec.MediaTypeImageManifest
+
+	case OrasReferrers:
+		if artifactType == "" {
+			artifactType = checkHealthArtifactType
+		}
+		artifactBytes, err = p.createORASArtifactReferrer(annotations, subject, layerDesc, artifactType)
+		mediaType = orasartifact.MediaTypeArtifactManifest
+
+	default:
+		return ociimagespec.Descriptor{}, fmt.Errorf("unknown referrers API version: %v", referrersVersion)
 	}
 
-	return referrers, nil
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	if tag == "" {
+		tag = digest.FromBytes(artifactBytes).String()
+	}
+
+	// Push artifact
+	artifactDesc, tripInfo, err := p.v2PutManifest(repo, tag, mediaType, artifactBytes)
+	if err != nil {
+		return ociimagespec.Descriptor{}, err
+	}
+
+	// Registries that process the subject of OCI manifests return its digest in the OCI-Subject header.
+	// See: https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-manifests-with-subject
+	if referrersVersion != OrasReferrers {
+		switch tripInfo.Response.HeaderSubject {
+		case subject.Digest.String():
+			p.Logger.Debug().Msg(fmt.Sprintf("%v header: %v", rhttp.HeaderSubject, tripInfo.Response.HeaderSubject))
+		case "":
+			p.Logger.Warn().Msg(fmt.Sprintf("registry accepted subject %v of %v@%v without returning the %v header", subject.Digest, repo, artifactDesc.Digest, rhttp.HeaderSubject))
+		default:
+			return ociimagespec.Descriptor{}, fmt.Errorf("%v header mismatch; expected: %v, got: %v", rhttp.HeaderSubject, subject.Digest, tripInfo.Response.HeaderSubject)
+		}
+	}
+
+	artifactDesc.ArtifactType = artifactType
+	artifactDesc.Annotations = annotations
+
+	return artifactDesc, nil
 }
 
-func (p Proxy) createOCIArtifactReferrer(annotations map[string]string, subject ociimagespec.Descriptor, layerDesc ociimagespec.Descriptor) ([]byte, error) {
+func (p Proxy) createOCIArtifactReferrer(annotations map[string]string, subject ociimagespec.Descriptor, layerDesc ociimagespec.Descriptor, artifactType string) ([]byte, error) {
 
 	artifact := ociimagespec.Artifact{
 		Blobs: []ociimagespec.Descriptor{
@@ -372,7 +478,7 @@ func (p Proxy) createOCIArtifactReferrer(annotations map[string]string, subject
 				Size:      layerDesc.Size,
 			},
 		},
-		ArtifactType: checkHealthArtifactType,
+		ArtifactType: artifactType,
 		Subject: &ociimagespec.Descriptor{
 			MediaType: subject.MediaType,
 			Digest:    subject.Digest,
@@ -394,7 +500,7 @@ func (p Proxy) createOCIManifestReferrer(annotations map[string]string, subject
 
 	artifact := ociimagespec.Manifest{
 		Config: ociimagespec.Descriptor{
-			MediaType: checkHealthMediaType,
+			MediaType: configDesc.MediaType,
 			Digest:    configDesc.Digest,
 			Size:      configDesc.Size,
 		},
@@ -425,7 +531,7 @@ func (p Proxy) createOCIManifestReferrer(annotations map[string]string, subject
 	return artifactBytes, nil
 }
 
-func (p Proxy) createORASArtifactReferrer(annotations map[string]string, subject ociimagespec.Descriptor, layerDesc ociimagespec.Descriptor) ([]byte, error) {
+func (p Proxy) createORASArtifactReferrer(annotations map[string]string, subject ociimagespec.Descriptor, layerDesc ociimagespec.Descriptor, artifactType string) ([]byte, error) {
 
 	artifact := orasartifact.Manifest{
 		Blobs: []orasartifact.Descriptor{
@@ -435,13 +541,14 @@ func (p Proxy) createORASArtifactReferrer(annotations map[string]string, subject
 				Size:      layerDesc.Size,
 			},
 		},
-		ArtifactType: checkHealthArtifactType,
+		ArtifactType: artifactType,
 		Subject: orasartifact.Descriptor{
 			MediaType: subject.MediaType,
 			Digest:    subject.Digest,
 			Size:      subject.Size,
 		},
-		MediaType: "application/vnd.cncf.oras.artifact.manifest.v1+json",
+		MediaType:   "application/vnd.cncf.oras.artifact.manifest.v1+json",
+		Annotations: annotations,
 	}
 
 	artifactBytes, err := json.Marshal(artifact)
@@ -511,7 +618,7 @@ func (p Proxy) verifyReferrers(repo string, subject ociimagespec.Descriptor, exp
 		return fmt.Errorf("unexpected referrers count, expected: %v, got: %v", len(expectedReferrers), len(discoveredReferrers))
 	}
 
-	matchedReferrers := make(map[string]string)
+	matchedReferrers := make(map[string]ociimagespec.Descriptor)
 
 	for _, discoveredReferrer := range discoveredReferrers {
 		for _, expectedReferrer := range expectedReferrers {
@@ -528,7 +635,7 @@ func (p Proxy) verifyReferrers(repo string, subject ociimagespec.Descriptor, exp
 
 				// Successfully discovered
 				p.Logger.Info().Msg(discoveredReferrer.Digest.String())
-				matchedReferrers[discoveredReferrer.Digest.String()] = ""
+				matchedReferrers[discoveredReferrer.Digest.String()] = expectedReferrer
 				break
 			}
 		}
@@ -542,32 +649,67 @@ func (p Proxy) verifyReferrers(repo string, subject ociimagespec.Descriptor, exp
 		p.Logger.Info().Msg(fmt.Sprintf("pull referrer %v@%v", repo, gotReferrer.Digest))
 
 		// Pull artifact manifest
-		pulledArtifactBytes, err := p.v2PullManifest(repo, gotReferrer.Digest.String(),
-			ociimagespec.Descriptor{MediaType: gotReferrer.MediaType, Digest: digest.Digest(gotReferrer.Digest), Size: gotReferrer.Size})
+		pulledArtifactBytes, err := p.v2PullManifest(repo, gotReferrer.Digest.String(), gotReferrer)
 		if err != nil {
 			return err
 		}
 
-		pulledArtifact := &orasartifact.Manifest{}
+		pulledArtifact := &manifestContent{}
 		if err = json.Unmarshal(pulledArtifactBytes, pulledArtifact); err != nil {
 			return err
 		}
 
-		// Pull artifact layer
-		if err = p.v2PullBlob(repo, ociimagespec.Descriptor{
-			MediaType: pulledArtifact.Blobs[0].MediaType,
-			Digest:    pulledArtifact.Blobs[0].Digest,
-			Size:      pulledArtifact.Blobs[0].Size,
-		}); err != nil {
-			return err
+		// Discovered metadata must round-trip from the pushed manifest
+		if err = verifyReferrerMetadata(gotReferrer, matchedReferrers[gotReferrer.Digest.String()], *pulledArtifact); err != nil {
+			return fmt.Errorf("referrer %v: %w", gotReferrer.Digest, err)
+		}
+
+		// Pull artifact blobs
+		for _, blob := range pulledArtifact.blobs() {
+			if err = p.v2PullBlob(repo, blob); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// verifyReferrerMetadata compares the artifactType and annotations of a discovered referrer with the pushed
+// referrer and with its manifest. Image manifests have no artifactType, so their config media type is used.
+func verifyReferrerMetadata(discovered, pushed ociimagespec.Descriptor, manifest manifestContent) error {
+	if discovered.ArtifactType != manifest.artifactType() {
+		return fmt.Errorf("artifactType mismatch with manifest; expected: %v, got: %v", manifest.artifactType(), discovered.ArtifactType)
+	}
+
+	if !annotationsEqual(discovered.Annotations, pushed.Annotations) {
+		return fmt.Errorf("annotations mismatch; expected: %v, got: %v", pushed.Annotations, discovered.Annotations)
+	}
+	if !annotationsEqual(discovered.Annotations, manifest.Annotations) {
+		return fmt.Errorf("annotations mismatch with manifest; expected: %v, got: %v", manifest.Annotations, discovered.Annotations)
+	}
+
+	return nil
+}
+
+// annotationsEqual reports whether a and b contain the same annotations. Nil and empty are equal.
+func annotationsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if got, ok := b[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
 // pullOCIImage pulls the image from repo by tag and validates against the given descriptor.
-func (p Proxy) pullOCIImage(repo, tag string, desc ociimagespec.Descriptor) error {
+func (p Proxy) pullOCIImage(repo, tag string, desc ociimagespec.Descriptor) (err error) {
+	p, span := p.startSpan("pull image", "oci.repository", repo, "oci.reference", tag)
+	defer func() { span.End(err) }()
+
 	p.Logger.Info().Msg(fmt.Sprintf("pull OCI image %v:%v", repo, tag))
 
 	pulledManifestBytes, err := p.v2PullManifest(repo, tag, desc)
@@ -585,16 +727,21 @@ func (p Proxy) pullOCIImage(repo, tag string, desc ociimagespec.Descriptor) erro
 		return err
 	}
 
-	// Pull layer blob
-	if err = p.v2PullBlob(repo, pulledManifest.Layers[0]); err != nil {
-		return err
+	// Pull layer blobs
+	for _, layer := range pulledManifest.Layers {
+		if err = p.v2PullBlob(repo, layer); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 // pushOCIImage creates and pushes a simple OCI application/vnd.oci.image.manifest.v1+json image.
-func (p Proxy) pushOCIImage(repo, tag string) (ociimagespec.Descriptor, error) {
+func (p Proxy) pushOCIImage(repo, tag string) (_ ociimagespec.Descriptor, err error) {
+	p, span := p.startSpan("push image", "oci.repository", repo, "oci.reference", tag)
+	defer func() { span.End(err) }()
+
 	p.Logger.Info().Msg(fmt.Sprintf("push OCI image %v:%v", repo, tag))
 
 	configBytes, err := json.Marshal(ociConfig)
@@ -639,56 +786,177 @@ func (p Proxy) pushOCIImage(repo, tag string) (ociimagespec.Descriptor, error) {
 	return p.v2PushManifest(repo, tag, ociimagespec.MediaTypeImageManifest, manifestBytes)
 }
 
-// getReferrers discovers referrers of the given subject using the referrers API.
+// getReferrers discovers referrers of the given subject using the referrers API, following pagination.
+// The ORAS API returns a list of references and the OCI API returns an image index.
 // See: https://gist.github.com/aviral26/ca4b0c1989fd978e74be75cbf3f3ea92
-func (p Proxy) getReferrers(repo string, subject digest.Digest, apiVersion string) ([]orasartifact.Descriptor, error) {
-	// OCI referrers
+// See: https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers
+func (p Proxy) getReferrers(repo string, subject digest.Digest, apiVersion string) ([]ociimagespec.Descriptor, error) {
+	referrers, _, err := p.getReferrersByType(repo, subject, apiVersion, "")
+	return referrers, err
+}
 
-	referrersUrl := p.url(p.LoginServer, fmt.Sprintf(ocirouteReferrers, repo, string(subject)))
-	if apiVersion == OrasReferrers {
-		referrersUrl = p.url(p.LoginServer, fmt.Sprintf(orasrouteReferrers, repo, string(subject)))
+// getReferrersByType discovers referrers of the given subject, asking the registry to filter them by
+// artifactType when it is set. It returns whether the registry reported applying the filter on every page.
+func (p Proxy) getReferrersByType(repo string, subject digest.Digest, apiVersion, artifactType string) ([]ociimagespec.Descriptor, bool, error) {
+	pages, err := p.getReferrersPages(repo, subject, apiVersion, artifactType)
+	if err != nil {
+		return nil, false, err
 	}
 
 	var (
-		referrers []orasartifact.Descriptor
-		page      int
+		referrers []ociimagespec.Descriptor
+		filtered  = artifactType != ""
 	)
+	for _, page := range pages {
+		referrers = append(referrers, page.referrers...)
+		if !page.filtered {
+			filtered = false
+		}
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("found %v referrers in %v pages", len(referrers), len(pages)))
+
+	return referrers, filtered, nil
+}
+
+// referrersPage is a single response of the referrers API.
+type referrersPage struct {
+	referrers []ociimagespec.Descriptor
+
+	// filtered is set if the registry reported applying the artifactType filter.
+	filtered bool
+
+	// elapsed is the duration of the round trip that fetched the page, excluding authentication.
+	elapsed time.Duration
+}
+
+// getReferrersPages fetches every page of referrers of the given subject, following Link headers.
+func (p Proxy) getReferrersPages(repo string, subject digest.Digest, apiVersion, artifactType string) (_ []referrersPage, err error) {
+	p, span := p.startSpan("discover referrers", "oci.repository", repo, "oci.subject", subject.String(), "oci.artifact_type", artifactType)
+	defer func() { span.End(err) }()
+
+	referrersURL := p.referrersURL(repo, subject, apiVersion)
+	if artifactType != "" {
+		referrersURL += "?" + url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+
+	var pages []referrersPage
 
 	for {
 		regReq := registryRequest{
 			method: http.MethodGet,
-			url:    referrersUrl,
+			url:    referrersURL,
 		}
 
-		page += 1
-
-		p.Logger.Debug().Msg(fmt.Sprintf("enumerating referrers page %v, %v", page, regReq.url))
+		p.Logger.Debug().Msg(fmt.Sprintf("enumerating referrers page %v, %v", len(pages)+1, regReq.url))
 
 		tripInfo, err := p.roundTrip(regReq, http.StatusOK, p.auth())
 		if err != nil {
 			return nil, err
 		}
+		elapsed := time.Since(tripInfo.StartedAt)
+
 		prettyJson, _ := PrettyString(fmt.Sprintf("%s\n", tripInfo.Body))
-		p.Logger.Info().Msg(prettyJson)
+		p.Logger.Debug().Msg(prettyJson)
+
+		pageReferrers, err := decodeReferrers(tripInfo, apiVersion)
+		if err != nil {
+			return nil, err
+		}
 
-		// referrers = append(referrers, resp.Referrers...)
+		pages = append(pages, referrersPage{
+			referrers: pageReferrers,
+			filtered:  filtersApplied(tripInfo.HeaderFilters, "artifactType"),
+			elapsed:   elapsed,
+		})
 
 		if tripInfo.HeaderLink == "" {
 			break
 		}
 
-		link := tripInfo.HeaderLink
-		referrersUrl = link[1:strings.Index(link, ">")]
+		referrersURL, err = p.nextLink(tripInfo.HeaderLink)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	p.Logger.Info().Msg(fmt.Sprintf("found %v referrers", len(referrers)))
+	return pages, nil
+}
 
-	return referrers, nil
+// referrersURL returns the referrers API URL of subject for the given API version.
+func (p Proxy) referrersURL(repo string, subject digest.Digest, apiVersion string) string {
+	if apiVersion == OrasReferrers {
+		return p.url(p.LoginServer, fmt.Sprintf(orasrouteReferrers, repo, string(subject)))
+	}
+	return p.url(p.LoginServer, fmt.Sprintf(ocirouteReferrers, repo, string(subject)))
+}
+
+// filtersApplied reports whether the OCI-Filters-Applied header value lists the given filter.
+func filtersApplied(header, filter string) bool {
+	for _, applied := range strings.Split(header, ",") {
+		if strings.TrimSpace(applied) == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeReferrers validates the content type of a referrers API response and decodes the referrers in it.
+func decodeReferrers(tripInfo rhttp.RoundTripInfo, apiVersion string) ([]ociimagespec.Descriptor, error) {
+	expectedContentType := ociimagespec.MediaTypeImageIndex
+	if apiVersion == OrasReferrers {
+		expectedContentType = "application/json"
+	}
+
+	contentType, _, err := mime.ParseMediaType(tripInfo.Response.HeaderContentType)
+	if err != nil || contentType != expectedContentType {
+		return nil, fmt.Errorf("referrers content type mismatch; expected: %v, got: %v", expectedContentType, tripInfo.Response.HeaderContentType)
+	}
+
+	if apiVersion == OrasReferrers {
+		var resp referrersResponse
+		if err := json.Unmarshal(tripInfo.Body, &resp); err != nil {
+			return nil, err
+		}
+
+		referrers := make([]ociimagespec.Descriptor, 0, len(resp.Referrers))
+		for _, r := range resp.Referrers {
+			referrers = append(referrers, ociimagespec.Descriptor{
+				MediaType:    r.MediaType,
+				ArtifactType: r.ArtifactType,
+				Digest:       r.Digest,
+				Size:         r.Size,
+				URLs:         r.URLs,
+				Annotations:  r.Annotations,
+			})
+		}
+		return referrers, nil
+	}
+
+	var index ociimagespec.Index
+	if err := json.Unmarshal(tripInfo.Body, &index); err != nil {
+		return nil, err
+	}
+	if index.SchemaVersion != 2 || index.MediaType != "" && index.MediaType != ociimagespec.MediaTypeImageIndex {
+		return nil, fmt.Errorf("invalid referrers index; schemaVersion: %v, mediaType: %v", index.SchemaVersion, index.MediaType)
+	}
+
+	return index.Manifests, nil
 }
 
 // v2PushManifest pushes the data to repo with the given tag and media type, returning the digest and size
 // of pushed content.
 func (p Proxy) v2PushManifest(repo, tag, mediaType string, manifestBytes []byte) (ociimagespec.Descriptor, error) {
+	desc, _, err := p.v2PutManifest(repo, tag, mediaType, manifestBytes)
+	return desc, err
+}
+
+// v2PutManifest pushes the data to repo like v2PushManifest, and also returns the round trip info so that
+// response headers can be inspected.
+func (p Proxy) v2PutManifest(repo, tag, mediaType string, manifestBytes []byte) (_ ociimagespec.Descriptor, _ rhttp.RoundTripInfo, err error) {
+	p, span := p.startSpan("push manifest", "oci.repository", repo, "oci.reference", tag)
+	defer func() { span.End(err) }()
+
 	manifestURL := p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, tag))
 
 	regReq := registryRequest{
@@ -698,9 +966,9 @@ func (p Proxy) v2PushManifest(repo, tag, mediaType string, manifestBytes []byte)
 		contentType: mediaType,
 	}
 
-	_, err := p.roundTrip(regReq, http.StatusCreated, p.auth())
+	tripInfo, err := p.roundTrip(regReq, http.StatusCreated, p.auth())
 	if err != nil {
-		return ociimagespec.Descriptor{}, err
+		return ociimagespec.Descriptor{}, tripInfo, err
 	}
 
 	dgst := digest.NewDigest(digest.SHA256, regReq.body.SHA256Hash())
@@ -709,11 +977,30 @@ func (p Proxy) v2PushManifest(repo, tag, mediaType string, manifestBytes []byte)
 		MediaType: mediaType,
 		Digest:    dgst,
 		Size:      regReq.body.N(),
-	}, nil
+	}, tripInfo, nil
+}
+
+// v2DeleteManifest deletes the manifest with the given digest from repo.
+func (p Proxy) v2DeleteManifest(repo string, dgst string) (err error) {
+	p, span := p.startSpan("delete manifest", "oci.repository", repo, "oci.digest", dgst)
+	defer func() { span.End(err) }()
+
+	regReq := registryRequest{
+		method: http.MethodDelete,
+		url:    p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, dgst)),
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("delete manifest %v@%v", repo, dgst))
+
+	_, err = p.roundTrip(regReq, http.StatusAccepted, p.auth())
+	return err
 }
 
 // v2PullManifest pulls manifest from repo specified by tag or digest and verifies the download size.
-func (p Proxy) v2PullManifest(repo, tagOrDigest string, desc ociimagespec.Descriptor) ([]byte, error) {
+func (p Proxy) v2PullManifest(repo, tagOrDigest string, desc ociimagespec.Descriptor) (_ []byte, err error) {
+	p, span := p.startSpan("pull manifest", "oci.repository", repo, "oci.reference", tagOrDigest)
+	defer func() { span.End(err) }()
+
 	manifestURL := p.url(p.LoginServer, fmt.Sprintf(routeManifest, repo, tagOrDigest))
 
 	regReq := registryRequest{
@@ -729,10 +1016,10 @@ func (p Proxy) v2PullManifest(repo, tagOrDigest string, desc ociimagespec.Descri
 
 	// Validate we got what we sent
 	if manifestPullTripInfo.Response.Size != desc.Size {
-		return nil, fmt.Errorf("manifest size mismatch; expected: %v, got: %v", desc.Size, manifestPullTripInfo.Response.Size)
+		return nil, withRequest(manifestPullTripInfo, integrityError("manifest size mismatch; expected: %v, got: %v", desc.Size, manifestPullTripInfo.Response.Size))
 	}
 	if manifestPullTripInfo.Response.SHA256Sum != desc.Digest {
-		return nil, fmt.Errorf("manifest digest mismatch; expected: %v, got: %v", desc.Digest, manifestPullTripInfo.Response.SHA256Sum)
+		return nil, withRequest(manifestPullTripInfo, integrityError("manifest digest mismatch; expected: %v, got: %v", desc.Digest, manifestPullTripInfo.Response.SHA256Sum))
 	}
 
 	return manifestPullTripInfo.Body, nil
@@ -740,6 +1027,15 @@ func (p Proxy) v2PullManifest(repo, tagOrDigest string, desc ociimagespec.Descri
 
 // v2PullBlob pulls a blob from the registry and verifies the digest
 func (p Proxy) v2PullBlob(repo string, desc ociimagespec.Descriptor) error {
+	_, err := p.v2FetchBlob(repo, desc)
+	return err
+}
+
+// v2FetchBlob pulls a blob from the registry, verifies the digest and returns its content.
+func (p Proxy) v2FetchBlob(repo string, desc ociimagespec.Descriptor) (_ []byte, err error) {
+	p, span := p.startSpan("pull blob", "oci.repository", repo, "oci.digest", desc.Digest.String())
+	defer func() { span.End(err) }()
+
 	var nextURL *url.URL
 
 	// Obtain SAS
@@ -751,38 +1047,39 @@ func (p Proxy) v2PullBlob(repo string, desc ociimagespec.Descriptor) error {
 
 		resp, err := p.roundTrip(regReq, http.StatusTemporaryRedirect, p.auth())
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		nextURL = resp.HeaderLocation
 	}
 
 	// Download content
-	{
-		regReq := registryRequest{
-			url:    nextURL.String(),
-			method: http.MethodGet,
-		}
+	regReq := registryRequest{
+		url:    nextURL.String(),
+		method: http.MethodGet,
+	}
 
-		tripInfo, err := p.roundTrip(regReq, http.StatusOK, noAuth)
-		if err != nil {
-			return err
-		}
+	tripInfo, err := p.roundTrip(regReq, http.StatusOK, noAuth)
+	if err != nil {
+		return nil, withCategory(ErrorCategoryDataEndpoint, err)
+	}
 
-		// Validate data integrity
-		if tripInfo.Response.SHA256Sum != desc.Digest {
-			return fmt.Errorf("blob digest mismatch; expected: %v, got: %v", desc.Digest, tripInfo.Response.SHA256Sum)
-		}
-		if tripInfo.Response.Size != desc.Size {
-			return fmt.Errorf("blob size mismatch; expected: %v, got: %v", desc.Size, tripInfo.Response.Size)
-		}
+	// Validate data integrity
+	if tripInfo.Response.SHA256Sum != desc.Digest {
+		return nil, withRequest(tripInfo, integrityError("blob digest mismatch; expected: %v, got: %v", desc.Digest, tripInfo.Response.SHA256Sum))
+	}
+	if tripInfo.Response.Size != desc.Size {
+		return nil, withRequest(tripInfo, integrityError("blob size mismatch; expected: %v, got: %v", desc.Size, tripInfo.Response.Size))
 	}
 
-	return nil
+	return tripInfo.Body, nil
 }
 
 // v2PushBlob uploads a blob to a repository
 func (p Proxy) v2PushBlob(repo string, data io.Reader) (d ociimagespec.Descriptor, err error) {
+	p, span := p.startSpan("push blob", "oci.repository", repo)
+	defer func() { span.End(err) }()
+
 	var nextURL *url.URL
 
 	// Initiate blob upload
@@ -860,12 +1157,14 @@ func (p Proxy) roundTrip(regReq registryRequest, expected int, at authType) (tri
 		return tripInfo, fmt.Errorf("unknown auth type: %v", at)
 	}
 
+	t.span = p.Span
+
 	result, err := t.roundTrip(regReq)
 	if err != nil {
 		return result, err
 	}
-	if result.Response.Code != expected {
-		return result, fmt.Errorf("invalid response code, expected: %v, got: %v, %s", expected, result.Response.Code, result.Response.Body)
+	if expected != anyStatusCode && result.Response.Code != expected {
+		return result, newError(result, expected)
 	}
 
 	return result, nil
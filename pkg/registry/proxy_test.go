@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+	"github.com/opencontainers/go-digest"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestDecodeReferrers(t *testing.T) {
+	referrer := ociimagespec.Descriptor{
+		MediaType:    ociimagespec.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.sbom",
+		Digest:       digest.FromString("sbom"),
+		Size:         42,
+		Annotations:  map[string]string{"created": "today"},
+	}
+
+	ociIndex := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example.sbom",` +
+		`"digest":"` + referrer.Digest.String() + `","size":42,"annotations":{"created":"today"}}]}`
+	orasResponse := `{"references":[` +
+		`{"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example.sbom",` +
+		`"digest":"` + referrer.Digest.String() + `","size":42,"annotations":{"created":"today"}}]}`
+
+	tests := []struct {
+		name        string
+		apiVersion  string
+		contentType string
+		body        string
+		want        []ociimagespec.Descriptor
+		wantErr     bool
+	}{
+		{
+			name:        "oci",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        ociIndex,
+			want:        []ociimagespec.Descriptor{referrer},
+		},
+		{
+			name:        "oci content type parameters",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex + "; charset=utf-8",
+			body:        ociIndex,
+			want:        []ociimagespec.Descriptor{referrer},
+		},
+		{
+			name:        "oci without media type",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        `{"schemaVersion":2,"manifests":[]}`,
+			want:        []ociimagespec.Descriptor{},
+		},
+		{
+			name:        "oci content type mismatch",
+			apiVersion:  OciReferrers,
+			contentType: "application/json",
+			body:        ociIndex,
+			wantErr:     true,
+		},
+		{
+			name:        "oci schema version mismatch",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        `{"schemaVersion":1,"manifests":[]}`,
+			wantErr:     true,
+		},
+		{
+			name:        "oci media type mismatch",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","manifests":[]}`,
+			wantErr:     true,
+		},
+		{
+			name:        "oci invalid json",
+			apiVersion:  OciReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        `{`,
+			wantErr:     true,
+		},
+		{
+			name:        "oras",
+			apiVersion:  OrasReferrers,
+			contentType: "application/json",
+			body:        orasResponse,
+			want:        []ociimagespec.Descriptor{referrer},
+		},
+		{
+			name:        "oras content type mismatch",
+			apiVersion:  OrasReferrers,
+			contentType: ociimagespec.MediaTypeImageIndex,
+			body:        orasResponse,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tripInfo := rhttp.RoundTripInfo{Response: rhttp.Response{HeaderContentType: tt.contentType, Body: []byte(tt.body)}}
+
+			got, err := decodeReferrers(tripInfo, tt.apiVersion)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeReferrers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeReferrers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,796 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/rs/zerolog"
+)
+
+// Artifact types used to check referrers filtering.
+var filterArtifactTypes = []string{
+	sbomArtifactType,
+	signatureArtifactType,
+	"application/vnd.acr.checkhealth.attestation",
+}
+
+// CheckReferrersFilter pushes referrers of several artifact types and verifies that referrers queries
+// filtered by artifactType return exactly the matching referrers. It reports whether the registry applied
+// each filter, as signaled by the OCI-Filters-Applied header, or the results had to be filtered by the client.
+func (p Proxy) CheckReferrersFilter(referrersVersion string) error {
+	if referrersVersion == OrasReferrers {
+		p.Logger.Info().Msg("artifactType filtering is not checked for the ORAS referrers API")
+		return nil
+	}
+
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		imageTag = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	// Push simple image
+	imageDesc, err := p.pushOCIImage(repo, imageTag)
+	if err != nil {
+		return err
+	}
+
+	// Push one referrer per artifact type, and two of the first
+	artifactTypes := append(append([]string(nil), filterArtifactTypes...), filterArtifactTypes[0])
+	var pushedReferrers []ociimagespec.Descriptor
+	for _, artifactType := range artifactTypes {
+		p.Logger.Info().Msg(fmt.Sprintf("push %v referrer of %v@%v", artifactType, repo, imageDesc.Digest))
+
+		referrer, err := p.pushReferrer(repo, "", imageDesc, referrersVersion, artifactType, nil)
+		if err != nil {
+			return err
+		}
+		pushedReferrers = append(pushedReferrers, referrer)
+	}
+
+	if err = p.waitForReferrers(repo, imageDesc.Digest, pushedReferrers, referrersVersion); err != nil {
+		return err
+	}
+
+	// Unfiltered discovery
+	if err = p.verifyReferrers(repo, imageDesc, pushedReferrers, referrersVersion); err != nil {
+		return err
+	}
+
+	// Filtered discovery
+	for _, artifactType := range filterArtifactTypes {
+		p.Logger.Info().Msg(fmt.Sprintf("discover %v referrers for %v@%v", artifactType, repo, imageDesc.Digest))
+
+		discovered, filtered, err := p.getReferrersByType(repo, imageDesc.Digest, referrersVersion, artifactType)
+		if err != nil {
+			return err
+		}
+
+		if filtered {
+			p.Logger.Info().Msg(fmt.Sprintf("registry applied artifactType filter %v", artifactType))
+		} else {
+			p.Logger.Warn().Msg(fmt.Sprintf("registry did not apply artifactType filter %v, filtering %v referrers on the client", artifactType, len(discovered)))
+			discovered = referrersOfType(discovered, artifactType)
+		}
+
+		if err = matchReferrers(discovered, referrersOfType(pushedReferrers, artifactType)); err != nil {
+			return fmt.Errorf("artifactType %v: %w", artifactType, err)
+		}
+	}
+
+	p.Logger.Info().Msg("check-referrers artifactType filter was successful")
+
+	return nil
+}
+
+// referrersOfType returns the referrers with the given artifact type.
+func referrersOfType(referrers []ociimagespec.Descriptor, artifactType string) []ociimagespec.Descriptor {
+	var matched []ociimagespec.Descriptor
+	for _, referrer := range referrers {
+		if referrer.ArtifactType == artifactType {
+			matched = append(matched, referrer)
+		}
+	}
+	return matched
+}
+
+// matchReferrers verifies that discovered holds exactly the expected referrers, compared by digest,
+// size, media type and artifact type.
+func matchReferrers(discovered, expected []ociimagespec.Descriptor) error {
+	key := func(d ociimagespec.Descriptor) string {
+		return fmt.Sprintf("%v %v %v %v", d.Digest, d.Size, d.MediaType, d.ArtifactType)
+	}
+
+	var got, want []string
+	for _, d := range discovered {
+		got = append(got, key(d))
+	}
+	for _, d := range expected {
+		want = append(want, key(d))
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		return fmt.Errorf("unexpected referrers, expected: [%v], got: [%v]", strings.Join(want, ", "), strings.Join(got, ", "))
+	}
+
+	return nil
+}
+
+// CheckReferrersFallback checks discovery of referrers through the referrers tag schema, which OCI clients
+// fall back to when the registry does not support the referrers API. Referrers are pushed while maintaining
+// the sha256-<hex> tag index of the subject, then discovered through the tag index. If the registry supports
+// the referrers API, both discovery paths must agree.
+// See: https://github.com/opencontainers/distribution-spec/blob/main/spec.md#referrers-tag-schema
+func (p Proxy) CheckReferrersFallback(count int, referrersVersion string) error {
+	if referrersVersion == OrasReferrers {
+		p.Logger.Info().Msg("the referrers tag schema is not checked for the ORAS referrers API")
+		return nil
+	}
+
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		imageTag = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	// Push simple image
+	imageDesc, err := p.pushOCIImage(repo, imageTag)
+	if err != nil {
+		return err
+	}
+
+	supported, err := p.referrersAPISupported(repo, imageDesc.Digest)
+	if err != nil {
+		return err
+	}
+	p.Logger.Info().Msg(fmt.Sprintf("referrers API supported: %v", supported))
+
+	if count < 1 {
+		count = 1
+	}
+
+	// Push referrers and maintain the tag index
+	var pushedReferrers []ociimagespec.Descriptor
+	for i := 0; i < count; i++ {
+		referrer, err := p.pushReferrer(repo, "", imageDesc, referrersVersion, "", nil)
+		if err != nil {
+			return err
+		}
+		pushedReferrers = append(pushedReferrers, referrer)
+
+		if err = p.addToReferrersTagIndex(repo, imageDesc.Digest, referrer); err != nil {
+			return err
+		}
+	}
+
+	// Discover through the tag index
+	p.Logger.Info().Msg(fmt.Sprintf("discover referrers for %v@%v through tag %v", repo, imageDesc.Digest, referrersTag(imageDesc.Digest)))
+	tagReferrers, err := p.getReferrersFromTagIndex(repo, imageDesc.Digest)
+	if err != nil {
+		return err
+	}
+	p.Logger.Info().Msg(fmt.Sprintf("found %v referrers in tag index", len(tagReferrers)))
+	if err = matchReferrers(tagReferrers, pushedReferrers); err != nil {
+		return fmt.Errorf("referrers tag index: %w", err)
+	}
+
+	// Discover through the referrers API
+	if supported {
+		apiReferrers, err := p.getReferrers(repo, imageDesc.Digest, referrersVersion)
+		if err != nil {
+			return err
+		}
+		if err = matchReferrers(apiReferrers, tagReferrers); err != nil {
+			return fmt.Errorf("referrers API and tag index disagree: %w", err)
+		}
+	}
+
+	p.Logger.Info().Msg("check-referrers tag schema fallback was successful")
+
+	return nil
+}
+
+// referrersTag returns the tag of the referrers tag schema index for the given subject.
+func referrersTag(subject digest.Digest) string {
+	return fmt.Sprintf("%v-%v", subject.Algorithm(), subject.Hex())
+}
+
+// referrersAPISupported reports whether the registry supports the OCI referrers API, which must answer
+// with 200 for any subject in an existing repository, and 404 when the API is not supported.
+func (p Proxy) referrersAPISupported(repo string, subject digest.Digest) (bool, error) {
+	regReq := registryRequest{
+		method: http.MethodGet,
+		url:    p.url(p.LoginServer, fmt.Sprintf(ocirouteReferrers, repo, subject)),
+	}
+
+	tripInfo, err := p.roundTrip(regReq, anyStatusCode, p.auth())
+	if err != nil {
+		return false, err
+	}
+
+	switch tripInfo.Response.Code {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, newError(tripInfo, http.StatusOK, http.StatusNotFound)
+	}
+}
+
+// getReferrersFromTagIndex reads the referrers of subject from its referrers tag schema index. A missing
+// tag means there are no referrers.
+func (p Proxy) getReferrersFromTagIndex(repo string, subject digest.Digest) ([]ociimagespec.Descriptor, error) {
+	tripInfo, err := p.v2GetManifest(repo, referrersTag(subject), ociimagespec.MediaTypeImageIndex, anyStatusCode)
+	if err != nil {
+		return nil, err
+	}
+
+	switch tripInfo.Response.Code {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, newError(tripInfo, http.StatusOK, http.StatusNotFound)
+	}
+
+	var index ociimagespec.Index
+	if err = json.Unmarshal(tripInfo.Body, &index); err != nil {
+		return nil, err
+	}
+
+	p.Logger.Debug().Msg(fmt.Sprintf("found %v referrers in tag index", len(index.Manifests)))
+
+	return index.Manifests, nil
+}
+
+// addToReferrersTagIndex adds referrer to the referrers tag schema index of subject, creating the index if
+// it does not exist, as OCI clients do when pushing to a registry without the referrers API.
+func (p Proxy) addToReferrersTagIndex(repo string, subject digest.Digest, referrer ociimagespec.Descriptor) error {
+	referrers, err := p.getReferrersFromTagIndex(repo, subject)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range referrers {
+		if r.Digest == referrer.Digest {
+			return nil
+		}
+	}
+
+	index := ociimagespec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociimagespec.MediaTypeImageIndex,
+		Manifests: append(referrers, referrer),
+	}
+
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("update referrers tag index %v:%v", repo, referrersTag(subject)))
+
+	_, err = p.v2PushManifest(repo, referrersTag(subject), ociimagespec.MediaTypeImageIndex, indexBytes)
+	return err
+}
+
+// ConsistencyOptions configures the referrers consistency probe.
+type ConsistencyOptions struct {
+	// Iterations is the number of referrers to push and delete.
+	Iterations int
+
+	// Interval is the time to wait between referrers queries.
+	Interval time.Duration
+
+	// Timeout is the maximum time to wait for a referrer to appear or disappear.
+	Timeout time.Duration
+}
+
+// CheckReferrersConsistency measures how long it takes for a pushed referrer to be returned by the
+// referrers API, and for a deleted referrer to no longer be returned, over several iterations.
+func (p Proxy) CheckReferrersConsistency(opts ConsistencyOptions, referrersVersion string) error {
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		imageTag = fmt.Sprintf("%v", time.Now().Unix())
+
+		visible, deleted Latencies
+		timeouts         int
+	)
+
+	if opts.Iterations < 1 {
+		return fmt.Errorf("at least 1 iteration required, got: %v", opts.Iterations)
+	}
+	if opts.Interval <= 0 {
+		return fmt.Errorf("positive interval required, got: %v", opts.Interval)
+	}
+
+	// Push simple image
+	imageDesc, err := p.pushOCIImage(repo, imageTag)
+	if err != nil {
+		return err
+	}
+
+	// Polling is not logged, only its warnings and errors.
+	quiet := p
+	quiet.Logger = p.Logger.Level(zerolog.WarnLevel)
+
+	for i := 0; i < opts.Iterations; i++ {
+		referrer, err := quiet.pushReferrer(repo, "", imageDesc, referrersVersion, "", nil)
+		if err != nil {
+			return err
+		}
+
+		elapsed, err := quiet.waitForReferrer(repo, imageDesc.Digest, referrer.Digest, referrersVersion, true, opts)
+		if err != nil {
+			return err
+		}
+		if elapsed < 0 {
+			timeouts++
+			p.Logger.Warn().Msg(fmt.Sprintf("iteration %v: referrer %v not visible after %v", i+1, referrer.Digest, opts.Timeout))
+
+			// Delete it anyway, so that it does not affect later iterations.
+			if err = p.v2DeleteManifest(repo, referrer.Digest.String()); err != nil {
+				return err
+			}
+			continue
+		}
+		visible = append(visible, elapsed)
+
+		if err = p.v2DeleteManifest(repo, referrer.Digest.String()); err != nil {
+			return err
+		}
+
+		elapsed, err = quiet.waitForReferrer(repo, imageDesc.Digest, referrer.Digest, referrersVersion, false, opts)
+		if err != nil {
+			return err
+		}
+		if elapsed < 0 {
+			timeouts++
+			p.Logger.Warn().Msg(fmt.Sprintf("iteration %v: deleted referrer %v still visible after %v", i+1, referrer.Digest, opts.Timeout))
+			continue
+		}
+		deleted = append(deleted, elapsed)
+
+		p.Logger.Info().Msg(fmt.Sprintf("iteration %v: visible after %v, gone after %v", i+1, visible[len(visible)-1], elapsed))
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("time until referrer visible: %v", visible))
+	p.Logger.Info().Msg(fmt.Sprintf("time until deleted referrer gone: %v", deleted))
+
+	if timeouts > 0 {
+		return fmt.Errorf("%v of %v iterations timed out", timeouts, opts.Iterations)
+	}
+
+	p.Logger.Info().Msg("check-referrers consistency probe was successful")
+
+	return nil
+}
+
+// waitForReferrer polls the referrers API until referrer is listed for subject, or is no longer listed if
+// present is false. It returns the time waited, or a negative duration on timeout.
+func (p Proxy) waitForReferrer(repo string, subject, referrer digest.Digest, referrersVersion string, present bool, opts ConsistencyOptions) (time.Duration, error) {
+	start := time.Now()
+	for {
+		referrers, err := p.getReferrers(repo, subject, referrersVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		found := false
+		for _, r := range referrers {
+			if r.Digest == referrer {
+				found = true
+				break
+			}
+		}
+		if found == present {
+			return time.Since(start), nil
+		}
+
+		if time.Since(start) > opts.Timeout {
+			return -1, nil
+		}
+
+		time.Sleep(opts.Interval)
+	}
+}
+
+// referrersWait is how referrers are polled until they are listed before they are verified.
+var referrersWait = ConsistencyOptions{Interval: 100 * time.Millisecond, Timeout: 30 * time.Second}
+
+// waitForReferrers polls the referrers API until every referrer is listed for subject, instead of waiting a
+// fixed time for the registry to index them. Each poll walks all pages once, however many referrers there are.
+func (p Proxy) waitForReferrers(repo string, subject digest.Digest, referrers []ociimagespec.Descriptor, referrersVersion string) error {
+	p.Logger.Info().Msg(fmt.Sprintf("wait for %v referrers of %v@%v", len(referrers), repo, subject))
+
+	// Polling is not logged, only its warnings and errors.
+	quiet := p
+	quiet.Logger = p.Logger.Level(zerolog.WarnLevel)
+
+	start := time.Now()
+	for {
+		listed, err := quiet.getReferrers(repo, subject, referrersVersion)
+		if err != nil {
+			return err
+		}
+
+		found := make(map[digest.Digest]bool)
+		for _, r := range listed {
+			found[r.Digest] = true
+		}
+		var missing int
+		for _, r := range referrers {
+			if !found[r.Digest] {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return nil
+		}
+
+		if time.Since(start) > referrersWait.Timeout {
+			return fmt.Errorf("%v of %v referrers not listed after %v", missing, len(referrers), referrersWait.Timeout)
+		}
+
+		time.Sleep(referrersWait.Interval)
+	}
+}
+
+// Artifact types of chained referrers.
+const (
+	sbomArtifactType      = "application/vnd.acr.checkhealth.sbom"
+	signatureArtifactType = "application/vnd.acr.checkhealth.signature"
+)
+
+// CheckReferrersGraph attaches referrers to an image index, to an image that is only pushed by digest, and
+// to other referrers, such as a signature of an SBOM. Referrers are discovered at every level of the graph.
+func (p Proxy) CheckReferrersGraph(referrersVersion string) error {
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		indexTag = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	// Index subject
+	indexDesc, err := p.pushImageIndex(repo, indexTag, []ociimagespec.Platform{defaultPlatform, {OS: "linux", Architecture: "arm64"}}, ociMediaTypes, nil)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push referrer of image index %v@%v", repo, indexDesc.Digest))
+	indexReferrer, err := p.pushReferrer(repo, "", indexDesc, referrersVersion, "", nil)
+	if err != nil {
+		return err
+	}
+
+	if err = p.waitForReferrers(repo, indexDesc.Digest, []ociimagespec.Descriptor{indexReferrer}, referrersVersion); err != nil {
+		return fmt.Errorf("image index subject: %w", err)
+	}
+	if err = p.verifyReferrers(repo, indexDesc, []ociimagespec.Descriptor{indexReferrer}, referrersVersion); err != nil {
+		return fmt.Errorf("image index subject: %w", err)
+	}
+
+	// Digest-only subject
+	imageDesc, err := p.pushPlatformImage(repo, defaultPlatform, ociMediaTypes)
+	if err != nil {
+		return err
+	}
+
+	// Chained referrers: subject <- SBOM <- signature
+	p.Logger.Info().Msg(fmt.Sprintf("push SBOM of untagged image %v@%v", repo, imageDesc.Digest))
+	sbomDesc, err := p.pushReferrer(repo, "", imageDesc, referrersVersion, sbomArtifactType, nil)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push signature of SBOM %v@%v", repo, sbomDesc.Digest))
+	signatureDesc, err := p.pushReferrer(repo, "", sbomDesc, referrersVersion, signatureArtifactType, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = p.waitForReferrers(repo, imageDesc.Digest, []ociimagespec.Descriptor{sbomDesc}, referrersVersion); err != nil {
+		return fmt.Errorf("untagged image subject: %w", err)
+	}
+	if err = p.waitForReferrers(repo, sbomDesc.Digest, []ociimagespec.Descriptor{signatureDesc}, referrersVersion); err != nil {
+		return fmt.Errorf("SBOM subject: %w", err)
+	}
+
+	// Each level only lists its direct referrers
+	if err = p.verifyReferrers(repo, imageDesc, []ociimagespec.Descriptor{sbomDesc}, referrersVersion); err != nil {
+		return fmt.Errorf("untagged image subject: %w", err)
+	}
+	if err = p.verifyReferrers(repo, sbomDesc, []ociimagespec.Descriptor{signatureDesc}, referrersVersion); err != nil {
+		return fmt.Errorf("SBOM subject: %w", err)
+	}
+	if err = p.verifyReferrers(repo, signatureDesc, nil, referrersVersion); err != nil {
+		return fmt.Errorf("signature subject: %w", err)
+	}
+
+	// Pull subjects
+	p.Logger.Info().Msg(fmt.Sprintf("subjects are %v:%v and %v@%v", repo, indexTag, repo, imageDesc.Digest))
+
+	if _, err = p.v2PullManifest(repo, indexTag, indexDesc); err != nil {
+		return err
+	}
+	if _, err = p.v2PullManifest(repo, imageDesc.Digest.String(), imageDesc); err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg("check-referrers graph was successful")
+
+	return nil
+}
+
+// PaginationOptions configures the referrers pagination stress test.
+type PaginationOptions struct {
+	// Referrers is the number of referrers to push.
+	Referrers int
+
+	// Concurrency is the number of referrers pushed at a time.
+	Concurrency int
+}
+
+// CheckReferrersPagination pushes many referrers of a subject concurrently, then walks every page of the
+// referrers API twice. It verifies that all referrers are discovered exactly once and in the same order, and
+// reports page sizes and per-page latency.
+func (p Proxy) CheckReferrersPagination(opts PaginationOptions, referrersVersion string) error {
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		imageTag = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	if opts.Referrers < 1 {
+		return fmt.Errorf("at least 1 referrer required, got: %v", opts.Referrers)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	// Push simple image
+	imageDesc, err := p.pushOCIImage(repo, imageTag)
+	if err != nil {
+		return err
+	}
+
+	pushedReferrers, err := p.pushReferrersConcurrently(repo, imageDesc, referrersVersion, opts)
+	if err != nil {
+		return err
+	}
+
+	// A partly indexed list would show up as missing referrers, or as an order change between walks.
+	if err = p.waitForReferrers(repo, imageDesc.Digest, pushedReferrers, referrersVersion); err != nil {
+		return err
+	}
+
+	var previous []ociimagespec.Descriptor
+	for walk := 1; walk <= 2; walk++ {
+		p.Logger.Info().Msg(fmt.Sprintf("walk %v: discover referrers for %v@%v", walk, repo, imageDesc.Digest))
+
+		pages, err := p.getReferrersPages(repo, imageDesc.Digest, referrersVersion, "")
+		if err != nil {
+			return err
+		}
+
+		var (
+			discovered []ociimagespec.Descriptor
+			sizes      = make([]int, len(pages))
+			elapsed    = make(Latencies, len(pages))
+			seen       = make(map[digest.Digest]int)
+		)
+		for i, page := range pages {
+			sizes[i] = len(page.referrers)
+			elapsed[i] = page.elapsed
+			for _, referrer := range page.referrers {
+				if first, ok := seen[referrer.Digest]; ok {
+					return fmt.Errorf("walk %v: referrer %v returned on page %v and page %v", walk, referrer.Digest, first, i+1)
+				}
+				seen[referrer.Digest] = i + 1
+				discovered = append(discovered, referrer)
+			}
+		}
+
+		p.Logger.Info().Msg(fmt.Sprintf("walk %v: found %v referrers in %v pages of sizes %v", walk, len(discovered), len(pages), sizes))
+		p.Logger.Info().Msg(fmt.Sprintf("walk %v: page latency %v", walk, elapsed))
+
+		if err = matchReferrers(discovered, pushedReferrers); err != nil {
+			return fmt.Errorf("walk %v: %w", walk, err)
+		}
+
+		if previous != nil {
+			for i := range discovered {
+				if discovered[i].Digest != previous[i].Digest {
+					return fmt.Errorf("referrers order changed between walks at position %v; expected: %v, got: %v", i, previous[i].Digest, discovered[i].Digest)
+				}
+			}
+		}
+		previous = discovered
+	}
+
+	p.Logger.Info().Msg("check-referrers pagination was successful")
+
+	return nil
+}
+
+// pushReferrersConcurrently pushes opts.Referrers referrers of subject, opts.Concurrency at a time.
+func (p Proxy) pushReferrersConcurrently(repo string, subject ociimagespec.Descriptor, referrersVersion string, opts PaginationOptions) ([]ociimagespec.Descriptor, error) {
+	p.Logger.Info().Msg(fmt.Sprintf("push %v referrers of %v@%v, %v at a time", opts.Referrers, repo, subject.Digest, opts.Concurrency))
+
+	// Individual pushes are not logged, only their warnings and errors.
+	quiet := p
+	quiet.Logger = p.Logger.Level(zerolog.WarnLevel)
+
+	var (
+		referrers = make([]ociimagespec.Descriptor, opts.Referrers)
+		errs      = make([]error, opts.Referrers)
+		indexes   = make(chan int)
+		wg        sync.WaitGroup
+		start     = time.Now()
+	)
+
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				tag := fmt.Sprintf("art-%d-%d", i+1, start.Unix())
+				referrers[i], errs[i] = quiet.pushReferrer(repo, tag, subject, referrersVersion, "", nil)
+			}
+		}()
+	}
+	for i := 0; i < opts.Referrers; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("pushed %v referrers in %v", opts.Referrers, time.Since(start)))
+
+	return referrers, nil
+}
+
+// CheckReferrersDeletion deletes a referrer and verifies that it is no longer discovered. It then deletes the
+// subject and reports what happens to its remaining referrer: whether discovery fails, the referrer is
+// deleted with its subject, or it is left orphaned. Finally, the subject is pushed again to see whether the
+// referrer is discovered again.
+func (p Proxy) CheckReferrersDeletion(referrersVersion string) error {
+	var (
+		repo     = fmt.Sprintf("%v%v", checkHealthRepoPrefix, time.Now().Unix())
+		imageTag = fmt.Sprintf("%v", time.Now().Unix())
+	)
+
+	imageDigest, _, _, mediaType, data, err := p.createOCIImage(repo, imageTag)
+	if err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg(fmt.Sprintf("push OCI image %v:%v", repo, imageTag))
+	imageDesc, err := p.v2PushManifest(repo, imageTag, mediaType, data)
+	if err != nil {
+		return err
+	}
+	if imageDesc.Digest != imageDigest {
+		return fmt.Errorf("subject digest mismatch; expected: %v, got: %v", imageDigest, imageDesc.Digest)
+	}
+
+	var pushedReferrers []ociimagespec.Descriptor
+	for i := 0; i < 2; i++ {
+		referrer, err := p.pushReferrer(repo, "", imageDesc, referrersVersion, "", nil)
+		if err != nil {
+			return err
+		}
+		pushedReferrers = append(pushedReferrers, referrer)
+	}
+	deletedReferrer, remainingReferrer := pushedReferrers[0], pushedReferrers[1]
+
+	if err = p.waitForReferrers(repo, imageDesc.Digest, pushedReferrers, referrersVersion); err != nil {
+		return err
+	}
+
+	// Delete a referrer
+	if err = p.v2DeleteManifest(repo, deletedReferrer.Digest.String()); err != nil {
+		return err
+	}
+
+	tripInfo, err := p.v2GetManifest(repo, deletedReferrer.Digest.String(), deletedReferrer.MediaType, anyStatusCode)
+	if err != nil {
+		return err
+	}
+	if tripInfo.Response.Code != http.StatusNotFound {
+		return fmt.Errorf("deleted referrer status code mismatch; expected: %v, got: %v", http.StatusNotFound, tripInfo.Response.Code)
+	}
+
+	// Deletion is eventually consistent, like pushes. Polling is not logged, only its warnings and errors.
+	quiet := p
+	quiet.Logger = p.Logger.Level(zerolog.WarnLevel)
+	elapsed, err := quiet.waitForReferrer(repo, imageDesc.Digest, deletedReferrer.Digest, referrersVersion, false, referrersWait)
+	if err != nil {
+		return err
+	}
+	if elapsed < 0 {
+		return fmt.Errorf("deleted referrer %v still listed after %v", deletedReferrer.Digest, referrersWait.Timeout)
+	}
+
+	if err = p.verifyReferrers(repo, imageDesc, []ociimagespec.Descriptor{remainingReferrer}, referrersVersion); err != nil {
+		return fmt.Errorf("after deleting referrer %v: %w", deletedReferrer.Digest, err)
+	}
+
+	// Delete the subject
+	if err = p.v2DeleteManifest(repo, imageDesc.Digest.String()); err != nil {
+		return err
+	}
+
+	if err = p.reportDanglingReferrer(repo, imageDesc, remainingReferrer, referrersVersion, "deleted"); err != nil {
+		return err
+	}
+
+	// Push the subject again
+	p.Logger.Info().Msg(fmt.Sprintf("push OCI image %v:%v again", repo, imageTag))
+	if _, err = p.v2PushManifest(repo, imageTag, mediaType, data); err != nil {
+		return err
+	}
+
+	if err = p.reportDanglingReferrer(repo, imageDesc, remainingReferrer, referrersVersion, "pushed again"); err != nil {
+		return err
+	}
+
+	p.Logger.Info().Msg("check-referrers deletion was successful")
+
+	return nil
+}
+
+// reportDanglingReferrer reports whether referrer of a subject that was deleted, or deleted and pushed again,
+// is still discovered and whether its manifest still exists.
+func (p Proxy) reportDanglingReferrer(repo string, subject, referrer ociimagespec.Descriptor, referrersVersion, state string) error {
+	p.Logger.Info().Msg(fmt.Sprintf("discover referrers for %v subject %v@%v", state, repo, subject.Digest))
+
+	// Every page is read, so that a referrer past the first page is not reported as orphaned.
+	var listed bool
+	discovered, err := p.getReferrers(repo, subject.Digest, referrersVersion)
+	var registryErr *Error
+	switch {
+	case err == nil:
+		for _, d := range discovered {
+			if d.Digest == referrer.Digest {
+				listed = true
+			}
+		}
+		p.Logger.Info().Msg(fmt.Sprintf("referrers of %v subject: found %v referrers", state, len(discovered)))
+	case errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusNotFound:
+		p.Logger.Info().Msg(fmt.Sprintf("referrers of %v subject: %v", state, err))
+	default:
+		return err
+	}
+
+	tripInfo, err := p.v2GetManifest(repo, referrer.Digest.String(), referrer.MediaType, anyStatusCode)
+	if err != nil {
+		return err
+	}
+	exists := tripInfo.Response.Code == http.StatusOK
+
+	switch {
+	case listed:
+		p.Logger.Info().Msg(fmt.Sprintf("referrer %v of %v subject is still listed", referrer.Digest, state))
+	case exists:
+		p.Logger.Warn().Msg(fmt.Sprintf("referrer %v of %v subject is orphaned: not listed, but its manifest still exists", referrer.Digest, state))
+	default:
+		p.Logger.Info().Msg(fmt.Sprintf("referrer %v of %v subject was deleted with its subject", referrer.Digest, state))
+	}
+
+	return nil
+}
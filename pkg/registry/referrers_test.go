@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ociimagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestMatchReferrers(t *testing.T) {
+	sbom := ociimagespec.Descriptor{
+		MediaType:    ociimagespec.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.sbom",
+		Digest:       digest.FromString("sbom"),
+		Size:         42,
+	}
+	signature := ociimagespec.Descriptor{
+		MediaType:    ociimagespec.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.signature",
+		Digest:       digest.FromString("signature"),
+		Size:         7,
+	}
+	with := func(d ociimagespec.Descriptor, change func(*ociimagespec.Descriptor)) ociimagespec.Descriptor {
+		change(&d)
+		return d
+	}
+
+	tests := []struct {
+		name       string
+		discovered []ociimagespec.Descriptor
+		expected   []ociimagespec.Descriptor
+		wantErr    bool
+	}{
+		{"none", nil, nil, false},
+		{"same", []ociimagespec.Descriptor{sbom, signature}, []ociimagespec.Descriptor{sbom, signature}, false},
+		{"any order", []ociimagespec.Descriptor{signature, sbom}, []ociimagespec.Descriptor{sbom, signature}, false},
+		{"annotations ignored", []ociimagespec.Descriptor{with(sbom, func(d *ociimagespec.Descriptor) {
+			d.Annotations = map[string]string{"created": "today"}
+		})}, []ociimagespec.Descriptor{sbom}, false},
+		{"missing", []ociimagespec.Descriptor{sbom}, []ociimagespec.Descriptor{sbom, signature}, true},
+		{"extra", []ociimagespec.Descriptor{sbom, signature}, []ociimagespec.Descriptor{sbom}, true},
+		{"duplicate", []ociimagespec.Descriptor{sbom, sbom}, []ociimagespec.Descriptor{sbom, signature}, true},
+		{"size", []ociimagespec.Descriptor{with(sbom, func(d *ociimagespec.Descriptor) { d.Size++ })}, []ociimagespec.Descriptor{sbom}, true},
+		{"media type", []ociimagespec.Descriptor{with(sbom, func(d *ociimagespec.Descriptor) {
+			d.MediaType = ociimagespec.MediaTypeImageIndex
+		})}, []ociimagespec.Descriptor{sbom}, true},
+		{"artifact type", []ociimagespec.Descriptor{with(sbom, func(d *ociimagespec.Descriptor) {
+			d.ArtifactType = signature.ArtifactType
+		})}, []ociimagespec.Descriptor{sbom}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := matchReferrers(tt.discovered, tt.expected); (err != nil) != tt.wantErr {
+				t.Errorf("matchReferrers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReferrersOfType(t *testing.T) {
+	referrers := []ociimagespec.Descriptor{
+		{ArtifactType: "application/vnd.example.sbom", Digest: digest.FromString("a")},
+		{ArtifactType: "application/vnd.example.signature", Digest: digest.FromString("b")},
+		{ArtifactType: "application/vnd.example.sbom", Digest: digest.FromString("c")},
+	}
+
+	got := referrersOfType(referrers, "application/vnd.example.sbom")
+	if len(got) != 2 || got[0].Digest != referrers[0].Digest || got[1].Digest != referrers[2].Digest {
+		t.Errorf("referrersOfType() = %+v, want the first and last referrers", got)
+	}
+	if got := referrersOfType(referrers, "application/vnd.example.other"); len(got) != 0 {
+		t.Errorf("referrersOfType() of an unknown type = %+v, want none", got)
+	}
+}
+
+func TestFiltersApplied(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"artifactType", true},
+		{"annotation, artifactType", true},
+		{"annotation,artifactType", true},
+		{"annotation", false},
+		{"artifactTypes", false},
+	}
+
+	for _, tt := range tests {
+		if got := filtersApplied(tt.header, "artifactType"); got != tt.want {
+			t.Errorf("filtersApplied(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
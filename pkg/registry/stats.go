@@ -0,0 +1,36 @@
+package registry
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Latencies is a collection of latency samples.
+type Latencies []time.Duration
+
+// Percentile returns the p-th percentile (0-100) of the samples using the nearest-rank method.
+func (l Latencies) Percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(l))
+	copy(sorted, l)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// String summarizes the samples.
+func (l Latencies) String() string {
+	if len(l) == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("n=%v p50=%v p90=%v p99=%v max=%v", len(l), l.Percentile(50), l.Percentile(90), l.Percentile(99), l.Percentile(100))
+}
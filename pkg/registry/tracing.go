@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
+)
+
+// startSpan starts the span of a step as a child of the span of p, with the given attribute name and value
+// pairs. It returns a copy of p whose steps and round trips are children of the new span.
+func (p Proxy) startSpan(name string, attributes ...string) (Proxy, *tracing.Span) {
+	span := p.Span.Child(name, tracing.SpanKindInternal)
+	for i := 0; i+1 < len(attributes); i += 2 {
+		span.SetAttribute(attributes[i], attributes[i+1])
+	}
+
+	if span != nil {
+		p.Span = span
+	}
+	return p, span
+}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 
 	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
 	"github.com/aviral26/acr-checkhealth/pkg/io"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
 	"github.com/rs/zerolog"
 )
 
@@ -41,6 +43,10 @@ type registryRequest struct {
 	body        io.Reader
 	contentType string
 	accept      string
+
+	// contentRange and contentLength, if set, describe a chunk of a blob upload.
+	contentRange  string
+	contentLength int64
 }
 
 // transport can be used to make HTTP requests with authentication.
@@ -51,6 +57,9 @@ type transport struct {
 	username string
 	password string
 	logger   zerolog.Logger
+
+	// span, if set, is the parent of the spans of round trips.
+	span *tracing.Span
 }
 
 // newTransport returns a new transport.
@@ -98,7 +107,7 @@ func newBearerAuthTransport(tripper rhttp.RoundTripper, username, password strin
 // roundTrip makes an HTTP request and returns the response body.
 // It supports basic and bearer authorization.
 func (t transport) roundTrip(regReq registryRequest) (tripInfo rhttp.RoundTripInfo, err error) {
-	req, err := http.NewRequest(regReq.method, regReq.url, regReq.body)
+	req, err := t.newRequest(regReq.method, regReq.url, regReq.body)
 	if err != nil {
 		return tripInfo, err
 	}
@@ -108,10 +117,14 @@ func (t transport) roundTrip(regReq registryRequest) (tripInfo rhttp.RoundTripIn
 	if regReq.accept != "" {
 		req.Header.Set(rhttp.HeaderAccept, regReq.accept)
 	}
+	if regReq.contentRange != "" {
+		req.Header.Set(rhttp.HeaderContentRange, regReq.contentRange)
+		req.ContentLength = regReq.contentLength
+	}
 
 	switch t.authType {
 	case bearerAuth:
-		tokenReq, err := http.NewRequest(regReq.method, regReq.url, nil)
+		tokenReq, err := t.newRequest(regReq.method, regReq.url, nil)
 		if err != nil {
 			return tripInfo, err
 		}
@@ -119,19 +132,23 @@ func (t transport) roundTrip(regReq registryRequest) (tripInfo rhttp.RoundTripIn
 		if err != nil {
 			return tripInfo, err
 		}
-		if tripInfo.Response.Code != http.StatusUnauthorized {
-			return tripInfo, errors.New("failed to get challenge")
+		if code := tripInfo.Response.Code; code != http.StatusUnauthorized {
+			category, ok := serverCategory(code)
+			if !ok {
+				category = ErrorCategoryAuthChallenge
+			}
+			return tripInfo, withRequest(tripInfo, withCategory(category, fmt.Errorf("failed to get challenge, expected: %v, got: %v", http.StatusUnauthorized, code)))
 		}
 		scheme, params := parseAuthHeader(tripInfo.Response.HeaderChallenge)
 		if scheme == schemeBearer {
 			token, err := t.getToken(params)
 			if err != nil {
-				return tripInfo, err
+				return tripInfo, withCategory(ErrorCategoryTokenServer, err)
 			}
 
 			req.Header.Set(rhttp.HeaderAuthorization, "Bearer "+token)
 		} else {
-			return tripInfo, errors.New("server does not support bearer authentication")
+			return tripInfo, withCategory(ErrorCategoryAuthChallenge, errors.New("server does not support bearer authentication"))
 		}
 	case basicAuth:
 		if t.username == "" {
@@ -148,13 +165,18 @@ func (t transport) roundTrip(regReq registryRequest) (tripInfo rhttp.RoundTripIn
 	return tripInfo, nil
 }
 
+// newRequest returns a request carrying the span of the transport.
+func (t transport) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	return http.NewRequestWithContext(tracing.ContextWithSpan(context.Background(), t.span), method, url, body)
+}
+
 // getToken attempts to get an auth token based on the given params.
 // The params specify:
 // - realm: the HTTP endpoint of the token server
 // - service: the service to obtain the token for, such as myregistry.azurecr.io
 // - scope: the authorization scope the token grants
 func (t transport) getToken(params map[string]string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, params[claimRealm], nil)
+	req, err := t.newRequest(http.MethodGet, params[claimRealm], nil)
 	if err != nil {
 		return "", err
 	}
@@ -176,7 +198,7 @@ func (t transport) getToken(params map[string]string) (string, error) {
 		return "", err
 	}
 	if tripInfo.Response.Code != http.StatusOK {
-		return "", fmt.Errorf("get access token failed, expected: 200, got: %v", tripInfo.Response.Code)
+		return "", withRequest(tripInfo, fmt.Errorf("get access token failed, expected: 200, got: %v", tripInfo.Response.Code))
 	}
 
 	var result struct {
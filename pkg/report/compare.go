@@ -0,0 +1,287 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Thresholds turn a comparison into a pass or fail gate. New failures always fail.
+type Thresholds struct {
+	// LatencyIncrease is the maximum relative increase of the mean latency of a step, such as 0.5 for 50%.
+	LatencyIncrease float64
+
+	// MinLatencyDelta is the minimum increase of the mean latency of a step to be a regression, so that
+	// fast steps do not fail on noise.
+	MinLatencyDelta time.Duration
+
+	// StatusCodes fails on changed status codes of any operation.
+	StatusCodes bool
+
+	// Network fails on changed DNS, IP or TLS facts of any host.
+	Network bool
+}
+
+// StepDelta compares the mean latency of a step. Steps missing from a report have no runs in it.
+type StepDelta struct {
+	Name     string `json:"name"`
+	Baseline *Step  `json:"baseline,omitempty"`
+	Current  *Step  `json:"current,omitempty"`
+
+	// Delta and Ratio compare the mean latencies, if the step ran in both.
+	Delta Duration `json:"delta"`
+	Ratio float64  `json:"ratio"`
+
+	Regression bool `json:"regression,omitempty"`
+	NewFailure bool `json:"newFailure,omitempty"`
+}
+
+// StatusChange lists the status codes of an operation that only one of the reports got.
+type StatusChange struct {
+	Operation string   `json:"operation"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+}
+
+// NetworkChange is a changed network fact of a host.
+type NetworkChange struct {
+	Host     string `json:"host"`
+	Fact     string `json:"fact"`
+	Baseline string `json:"baseline"`
+	Current  string `json:"current"`
+}
+
+// Comparison is the comparison of a run with a baseline run.
+type Comparison struct {
+	Steps          []StepDelta     `json:"steps"`
+	NewFailures    []string        `json:"newFailures,omitempty"`
+	StatusChanges  []StatusChange  `json:"statusChanges,omitempty"`
+	NetworkChanges []NetworkChange `json:"networkChanges,omitempty"`
+
+	// Regressions are the reasons the comparison failed the thresholds.
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+// Passed reports whether the run passed the thresholds.
+func (c Comparison) Passed() bool {
+	return len(c.Regressions) == 0
+}
+
+// Compare compares the current run with the baseline run.
+func Compare(baseline, current Report, t Thresholds) Comparison {
+	var c Comparison
+
+	if baseline.Error == "" && current.Error != "" {
+		failure := fmt.Sprintf("run failed: [%v] %v", current.Category, current.Error)
+		c.NewFailures = append(c.NewFailures, failure)
+		c.Regressions = append(c.Regressions, failure)
+	}
+
+	c.compareSteps(baseline.Steps, current.Steps, t)
+	c.compareStatusCodes(baseline.Requests, current.Requests, t)
+	c.compareHosts(baseline.Hosts, current.Hosts, t)
+
+	return c
+}
+
+// compareSteps compares the latency and failures of each step, in the order of the current run.
+func (c *Comparison) compareSteps(baseline, current []Step, t Thresholds) {
+	baselineSteps := make(map[string]*Step)
+	for i := range baseline {
+		baselineSteps[baseline[i].Name] = &baseline[i]
+	}
+
+	seen := make(map[string]bool)
+	for i := range current {
+		cur := &current[i]
+		seen[cur.Name] = true
+
+		delta := StepDelta{Name: cur.Name, Baseline: baselineSteps[cur.Name], Current: cur}
+		base := delta.Baseline
+
+		if base != nil {
+			delta.Delta = cur.Mean - base.Mean
+			if base.Mean > 0 {
+				delta.Ratio = float64(cur.Mean) / float64(base.Mean)
+			}
+
+			if delta.Ratio > 1+t.LatencyIncrease && time.Duration(delta.Delta) >= t.MinLatencyDelta {
+				delta.Regression = true
+				c.Regressions = append(c.Regressions, fmt.Sprintf("%v is %.0f%% slower: %v, was %v",
+					cur.Name, (delta.Ratio-1)*100, cur.Mean, base.Mean))
+			}
+		}
+
+		if cur.Failures > 0 && (base == nil || base.Failures == 0) {
+			delta.NewFailure = true
+			failure := fmt.Sprintf("%v failed: %v", cur.Name, cur.Error)
+			c.NewFailures = append(c.NewFailures, failure)
+			c.Regressions = append(c.Regressions, failure)
+		}
+
+		c.Steps = append(c.Steps, delta)
+	}
+
+	// Steps that did not run are listed, but are not regressions by themselves. A failure that skipped
+	// them is.
+	for i := range baseline {
+		if !seen[baseline[i].Name] {
+			c.Steps = append(c.Steps, StepDelta{Name: baseline[i].Name, Baseline: &baseline[i]})
+		}
+	}
+}
+
+// compareStatusCodes compares the status codes of each operation. Counts are not compared, as they depend
+// on the size of the run.
+func (c *Comparison) compareStatusCodes(baseline, current []Requests, t Thresholds) {
+	codes := func(requests []Requests) map[string]map[string]int {
+		byOperation := make(map[string]map[string]int)
+		for _, r := range requests {
+			byOperation[r.Operation] = r.Codes
+		}
+		return byOperation
+	}
+	baselineCodes, currentCodes := codes(baseline), codes(current)
+
+	var operations []string
+	for _, r := range append(append([]Requests(nil), baseline...), current...) {
+		operations = append(operations, r.Operation)
+	}
+
+	for _, operation := range union(operations) {
+		change := StatusChange{
+			Operation: operation,
+			Added:     missingKeys(currentCodes[operation], baselineCodes[operation]),
+			Removed:   missingKeys(baselineCodes[operation], currentCodes[operation]),
+		}
+		if len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+
+		c.StatusChanges = append(c.StatusChanges, change)
+		if t.StatusCodes {
+			c.Regressions = append(c.Regressions, fmt.Sprintf("%v status codes changed: added %v, removed %v",
+				operation, orNone(change.Added), orNone(change.Removed)))
+		}
+	}
+}
+
+// compareHosts compares the network facts of each host.
+func (c *Comparison) compareHosts(baseline, current []Host, t Thresholds) {
+	facts := func(hosts []Host) map[string]map[string]string {
+		byHost := make(map[string]map[string]string)
+		for _, host := range hosts {
+			byHost[host.Name] = host.facts()
+		}
+		return byHost
+	}
+	baselineFacts, currentFacts := facts(baseline), facts(current)
+
+	var hosts []string
+	for _, host := range append(append([]Host(nil), baseline...), current...) {
+		hosts = append(hosts, host.Name)
+	}
+
+	for _, host := range union(hosts) {
+		base, cur := baselineFacts[host], currentFacts[host]
+
+		// Hosts that were not connected to in one of the runs only differ in that.
+		if base == nil || cur == nil {
+			c.addNetworkChange(NetworkChange{Host: host, Fact: "host", Baseline: presence(base), Current: presence(cur)}, t)
+			continue
+		}
+
+		var facts []string
+		for fact := range base {
+			facts = append(facts, fact)
+		}
+		for fact := range cur {
+			facts = append(facts, fact)
+		}
+
+		for _, fact := range union(facts) {
+			if base[fact] != cur[fact] {
+				c.addNetworkChange(NetworkChange{Host: host, Fact: fact, Baseline: base[fact], Current: cur[fact]}, t)
+			}
+		}
+	}
+}
+
+// addNetworkChange adds a changed network fact, which is a regression if the thresholds say so.
+func (c *Comparison) addNetworkChange(change NetworkChange, t Thresholds) {
+	c.NetworkChanges = append(c.NetworkChanges, change)
+	if t.Network {
+		c.Regressions = append(c.Regressions, fmt.Sprintf("%v %v changed: %v, was %v",
+			change.Host, change.Fact, orNone(change.Current), orNone(change.Baseline)))
+	}
+}
+
+// facts returns the network facts of the host by name. Facts that were not observed are empty.
+func (h Host) facts() map[string]string {
+	facts := map[string]string{
+		"dns": strings.Join(h.DNS, " -> "),
+		"ips": strings.Join(h.IPs, ", "),
+	}
+	if h.TLS != nil {
+		facts["tls version"] = h.TLS.Version
+		facts["tls cipher suite"] = h.TLS.CipherSuite
+		facts["certificate subject"] = h.TLS.Subject
+		facts["certificate issuer"] = h.TLS.Issuer
+		facts["certificate fingerprint"] = h.TLS.Fingerprint
+		if !h.TLS.NotAfter.IsZero() {
+			facts["certificate expiry"] = h.TLS.NotAfter.UTC().Format(time.RFC3339)
+		}
+	}
+	return facts
+}
+
+// union returns the distinct values, sorted.
+func union(values []string) []string {
+	seen := make(map[string]bool)
+	var distinct []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			distinct = append(distinct, v)
+		}
+	}
+	sort.Strings(distinct)
+	return distinct
+}
+
+// missingKeys returns the keys of a that are not in b, sorted.
+func missingKeys(a, b map[string]int) []string {
+	var missing []string
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// presence describes whether a host was connected to.
+func presence(facts map[string]string) string {
+	if facts == nil {
+		return ""
+	}
+	return "present"
+}
+
+// orNone returns the value, or "none" if it is empty.
+func orNone(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if v == "" {
+			return "none"
+		}
+	case []string:
+		if len(v) == 0 {
+			return "none"
+		}
+		return strings.Join(v, ", ")
+	}
+	return v
+}
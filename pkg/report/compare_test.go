@@ -0,0 +1,144 @@
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompareLatency(t *testing.T) {
+	thresholds := Thresholds{LatencyIncrease: 0.5, MinLatencyDelta: 50 * time.Millisecond}
+
+	tests := []struct {
+		name     string
+		baseline time.Duration
+		current  time.Duration
+		want     bool
+	}{
+		{"unchanged", 100 * time.Millisecond, 100 * time.Millisecond, false},
+		{"faster", 100 * time.Millisecond, 10 * time.Millisecond, false},
+		{"within increase", 200 * time.Millisecond, 290 * time.Millisecond, false},
+		{"over increase and delta", 200 * time.Millisecond, 400 * time.Millisecond, true},
+		{"over increase under delta", 10 * time.Millisecond, 50 * time.Millisecond, false},
+		{"over delta under increase", time.Second, 1200 * time.Millisecond, false},
+		{"at delta", 40 * time.Millisecond, 90 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseline := Report{Steps: []Step{{Name: "push", Runs: 1, Mean: Duration(tt.baseline)}}}
+			current := Report{Steps: []Step{{Name: "push", Runs: 1, Mean: Duration(tt.current)}}}
+
+			c := Compare(baseline, current, thresholds)
+			if len(c.Steps) != 1 {
+				t.Fatalf("got %v steps, want 1", len(c.Steps))
+			}
+			if got := c.Steps[0].Regression; got != tt.want {
+				t.Errorf("Regression = %v, want %v", got, tt.want)
+			}
+			if got := !c.Passed(); got != tt.want {
+				t.Errorf("failed = %v, want %v", got, tt.want)
+			}
+			if got := time.Duration(c.Steps[0].Delta); got != tt.current-tt.baseline {
+				t.Errorf("Delta = %v, want %v", got, tt.current-tt.baseline)
+			}
+		})
+	}
+}
+
+func TestCompareFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseline Report
+		current  Report
+		want     []string
+	}{
+		{
+			name:     "newly failing step",
+			baseline: Report{Steps: []Step{{Name: "push", Runs: 1}}},
+			current:  Report{Steps: []Step{{Name: "push", Runs: 1, Failures: 1, Error: "boom"}}},
+			want:     []string{"push failed: boom"},
+		},
+		{
+			name:     "new step failing",
+			baseline: Report{},
+			current:  Report{Steps: []Step{{Name: "push", Runs: 1, Failures: 1, Error: "boom"}}},
+			want:     []string{"push failed: boom"},
+		},
+		{
+			name:     "still failing step",
+			baseline: Report{Steps: []Step{{Name: "push", Runs: 1, Failures: 1, Error: "boom"}}},
+			current:  Report{Steps: []Step{{Name: "push", Runs: 1, Failures: 1, Error: "boom"}}},
+		},
+		{
+			name:     "failing run",
+			baseline: Report{},
+			current:  Report{Error: "boom", Category: "server-error"},
+			want:     []string{"run failed: [server-error] boom"},
+		},
+		{
+			name:     "step not run",
+			baseline: Report{Steps: []Step{{Name: "push", Runs: 1}, {Name: "pull", Runs: 1}}},
+			current:  Report{Steps: []Step{{Name: "push", Runs: 1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Compare(tt.baseline, tt.current, Thresholds{})
+			if !reflect.DeepEqual(c.NewFailures, tt.want) {
+				t.Errorf("NewFailures = %q, want %q", c.NewFailures, tt.want)
+			}
+			if got, want := c.Passed(), len(tt.want) == 0; got != want {
+				t.Errorf("Passed() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCompareStatusCodes(t *testing.T) {
+	baseline := Report{Requests: []Requests{
+		{Operation: "ping", Codes: map[string]int{"200": 1, "401": 1}},
+		{Operation: "token", Codes: map[string]int{"200": 4}},
+	}}
+	current := Report{Requests: []Requests{
+		{Operation: "ping", Codes: map[string]int{"200": 3, "429": 1}},
+		{Operation: "token", Codes: map[string]int{"200": 9}},
+	}}
+	want := []StatusChange{{Operation: "ping", Added: []string{"429"}, Removed: []string{"401"}}}
+
+	for _, fail := range []bool{false, true} {
+		c := Compare(baseline, current, Thresholds{StatusCodes: fail})
+		if !reflect.DeepEqual(c.StatusChanges, want) {
+			t.Errorf("StatusChanges = %+v, want %+v", c.StatusChanges, want)
+		}
+		if got := c.Passed(); got == fail {
+			t.Errorf("Passed() with StatusCodes %v = %v", fail, got)
+		}
+	}
+}
+
+func TestCompareNetwork(t *testing.T) {
+	baseline := Report{Hosts: []Host{
+		{Name: "a.azurecr.io", DNS: []string{"a.azurecr.io", "10.0.0.1"}, IPs: []string{"10.0.0.1"}, TLS: &TLSFacts{Version: "TLS 1.2"}},
+		{Name: "gone.azurecr.io"},
+	}}
+	current := Report{Hosts: []Host{
+		{Name: "a.azurecr.io", DNS: []string{"a.azurecr.io", "10.0.0.2"}, IPs: []string{"10.0.0.2"}, TLS: &TLSFacts{Version: "TLS 1.2"}},
+	}}
+	want := []NetworkChange{
+		{Host: "a.azurecr.io", Fact: "dns", Baseline: "a.azurecr.io -> 10.0.0.1", Current: "a.azurecr.io -> 10.0.0.2"},
+		{Host: "a.azurecr.io", Fact: "ips", Baseline: "10.0.0.1", Current: "10.0.0.2"},
+		{Host: "gone.azurecr.io", Fact: "host", Baseline: "present", Current: ""},
+	}
+
+	for _, fail := range []bool{false, true} {
+		c := Compare(baseline, current, Thresholds{Network: fail})
+		if !reflect.DeepEqual(c.NetworkChanges, want) {
+			t.Errorf("NetworkChanges = %+v, want %+v", c.NetworkChanges, want)
+		}
+		if got := c.Passed(); got == fail {
+			t.Errorf("Passed() with Network %v = %v", fail, got)
+		}
+	}
+}
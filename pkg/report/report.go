@@ -0,0 +1,386 @@
+package report
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rhttp "github.com/aviral26/acr-checkhealth/pkg/http"
+	"github.com/aviral26/acr-checkhealth/pkg/metrics"
+	"github.com/aviral26/acr-checkhealth/pkg/registry"
+	"github.com/aviral26/acr-checkhealth/pkg/tracing"
+)
+
+// stepSeparator separates the names of nested steps.
+const stepSeparator = " > "
+
+// tlsVersions are the names of TLS versions.
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// Duration is a duration encoded in JSON as a string, such as "1.5s".
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// String formats the duration like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Report is the structured outcome of a run, which can be compared with the report of another run.
+type Report struct {
+	Command     string                 `json:"command"`
+	LoginServer string                 `json:"loginServer"`
+	Version     string                 `json:"version"`
+	StartedAt   time.Time              `json:"startedAt"`
+	Duration    Duration               `json:"duration"`
+	Error       string                 `json:"error,omitempty"`
+	Category    registry.ErrorCategory `json:"category,omitempty"`
+
+	// Steps are the steps of the run in the order they started. Repeated steps are aggregated.
+	Steps []Step `json:"steps"`
+
+	// Requests are the requests of the run by operation.
+	Requests []Requests `json:"requests"`
+
+	// Hosts are the facts of the hosts the run connected to.
+	Hosts []Host `json:"hosts"`
+
+	FailedRequests []registry.RequestInfo `json:"failedRequests,omitempty"`
+}
+
+// Step is a step of a run, such as pushing an image, named after its parent steps.
+type Step struct {
+	Name     string   `json:"name"`
+	Runs     int      `json:"runs"`
+	Failures int      `json:"failures,omitempty"`
+	Mean     Duration `json:"mean"`
+	Max      Duration `json:"max"`
+
+	// Error is the error of the first failure.
+	Error string `json:"error,omitempty"`
+}
+
+// Requests are the requests of an operation, such as manifest-put.
+type Requests struct {
+	Operation string         `json:"operation"`
+	Count     int            `json:"count"`
+	Codes     map[string]int `json:"codes"`
+	Mean      Duration       `json:"mean"`
+	Max       Duration       `json:"max"`
+}
+
+// Host holds the network facts of a host.
+type Host struct {
+	Name string `json:"name"`
+
+	// DNS is the resolution of the name through its aliases to its IP addresses, if it was resolved. The
+	// last element lists the addresses, sorted and comma separated.
+	DNS []string `json:"dns,omitempty"`
+
+	// IPs are the addresses connected to.
+	IPs []string  `json:"ips,omitempty"`
+	TLS *TLSFacts `json:"tls,omitempty"`
+}
+
+// TLSFacts describe the TLS connection and the certificate of a host.
+type TLSFacts struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipherSuite"`
+	Subject     string    `json:"subject,omitempty"`
+	Issuer      string    `json:"issuer,omitempty"`
+	NotAfter    time.Time `json:"notAfter,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+}
+
+// ReadFile reads a report.
+func ReadFile(path string) (Report, error) {
+	var r Report
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(b, &r)
+	return r, err
+}
+
+// WriteFile writes the report as indented JSON. The file is replaced atomically.
+func (r Report) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := json.NewEncoder(tmp)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Recorder records the steps, requests and network facts of a run.
+type Recorder struct {
+	mu        sync.Mutex
+	stepStats map[string]*stepStats
+	requests  map[string]*requests
+	order     []string
+	hosts     map[string]*Host
+}
+
+// stepStats aggregates the runs of a step.
+type stepStats struct {
+	first    time.Time
+	runs     int
+	failures int
+	total    time.Duration
+	max      time.Duration
+	err      string
+}
+
+// requests aggregates the requests of an operation.
+type requests struct {
+	count int
+	codes map[string]int
+	total time.Duration
+	max   time.Duration
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		stepStats: make(map[string]*stepStats),
+		requests:  make(map[string]*requests),
+		hosts:     make(map[string]*Host),
+	}
+}
+
+// ObserveSpan records an ended span as a run of the step named after it and its parents. Round trips are
+// recorded by ObserveRoundTrip instead. It can be used as tracing.Tracer.OnEnd.
+func (r *Recorder) ObserveSpan(span *tracing.Span) {
+	if span.Kind == tracing.SpanKindClient {
+		return
+	}
+
+	name := strings.Join(span.Path(), stepSeparator)
+	duration := span.Duration()
+	msg, failed := span.Error()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.stepStats[name]
+	if !ok {
+		stats = &stepStats{first: span.Start}
+		r.stepStats[name] = stats
+	}
+	if span.Start.Before(stats.first) {
+		stats.first = span.Start
+	}
+	stats.runs++
+	stats.total += duration
+	if duration > stats.max {
+		stats.max = duration
+	}
+	if failed {
+		stats.failures++
+		if stats.err == "" {
+			stats.err = msg
+		}
+	}
+}
+
+// ObserveRoundTrip records a round trip. It can be used with rhttp.Observe.
+func (r *Recorder) ObserveRoundTrip(info rhttp.RoundTripInfo, err error) {
+	code := "error"
+	if err == nil || info.Response.Code != 0 {
+		code = strconv.Itoa(info.Response.Code)
+	}
+	elapsed, _ := time.ParseDuration(info.Elapsed)
+	operation := metrics.Operation(info)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.requests[operation]
+	if !ok {
+		stats = &requests{codes: make(map[string]int)}
+		r.requests[operation] = stats
+		r.order = append(r.order, operation)
+	}
+	stats.count++
+	stats.codes[code]++
+	stats.total += elapsed
+	if elapsed > stats.max {
+		stats.max = elapsed
+	}
+
+	if info.Request.URL == nil {
+		return
+	}
+	host := r.host(info.Request.URL.Hostname())
+	if ip, _, splitErr := net.SplitHostPort(info.Response.RemoteAddr); splitErr == nil && !contains(host.IPs, ip) {
+		host.IPs = append(host.IPs, ip)
+		sort.Strings(host.IPs)
+	}
+	if info.Response.TLS != nil && host.TLS == nil {
+		host.TLS = newTLSFacts(info.Response.TLS)
+	}
+}
+
+// ObserveDNS records the resolution of a hostname through its aliases to its IP addresses.
+func (r *Recorder) ObserveDNS(hostname string, path []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.host(hostname).DNS = path
+}
+
+// Report returns the report of a run of command against loginServer that started at start and ended with
+// err.
+func (r *Recorder) Report(command, loginServer, version string, start time.Time, err error, failed []registry.RequestInfo) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Command:        command,
+		LoginServer:    loginServer,
+		Version:        version,
+		StartedAt:      start,
+		Duration:       Duration(time.Since(start)),
+		Steps:          r.steps(),
+		Requests:       []Requests{},
+		Hosts:          []Host{},
+		FailedRequests: failed,
+	}
+	if err != nil {
+		report.Error = err.Error()
+		report.Category = registry.Classify(err)
+	}
+
+	for _, operation := range r.order {
+		stats := r.requests[operation]
+		report.Requests = append(report.Requests, Requests{
+			Operation: operation,
+			Count:     stats.count,
+			Codes:     stats.codes,
+			Mean:      Duration(stats.total / time.Duration(stats.count)),
+			Max:       Duration(stats.max),
+		})
+	}
+
+	for _, host := range r.hosts {
+		report.Hosts = append(report.Hosts, *host)
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool {
+		return report.Hosts[i].Name < report.Hosts[j].Name
+	})
+
+	return report
+}
+
+// steps returns the recorded steps in the order they first started.
+func (r *Recorder) steps() []Step {
+	names := make([]string, 0, len(r.stepStats))
+	for name := range r.stepStats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return r.stepStats[names[i]].first.Before(r.stepStats[names[j]].first)
+	})
+
+	steps := []Step{}
+	for _, name := range names {
+		stats := r.stepStats[name]
+		steps = append(steps, Step{
+			Name:     name,
+			Runs:     stats.runs,
+			Failures: stats.failures,
+			Mean:     Duration(stats.total / time.Duration(stats.runs)),
+			Max:      Duration(stats.max),
+			Error:    stats.err,
+		})
+	}
+	return steps
+}
+
+// host returns the facts of a host, adding it if needed.
+func (r *Recorder) host(name string) *Host {
+	host, ok := r.hosts[name]
+	if !ok {
+		host = &Host{Name: name}
+		r.hosts[name] = host
+	}
+	return host
+}
+
+// newTLSFacts returns the facts of a TLS connection.
+func newTLSFacts(state *tls.ConnectionState) *TLSFacts {
+	facts := &TLSFacts{
+		Version:     tlsVersions[state.Version],
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		sum := sha256.Sum256(cert.Raw)
+
+		facts.Subject = cert.Subject.CommonName
+		facts.Issuer = cert.Issuer.CommonName
+		facts.NotAfter = cert.NotAfter
+		facts.Fingerprint = hex.EncodeToString(sum[:])
+	}
+	return facts
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpTracesPath is appended to the endpoint, as for OTEL_EXPORTER_OTLP_ENDPOINT.
+const otlpTracesPath = "/v1/traces"
+
+// OTLP status codes.
+const (
+	statusCodeUnset = 0
+	statusCodeError = 2
+)
+
+// Exporter exports spans to an OpenTelemetry collector with OTLP over HTTP, encoded as JSON.
+// See: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type Exporter struct {
+	// Endpoint is the base URL of the collector, such as http://localhost:4318.
+	Endpoint string
+
+	// ServiceName and ServiceVersion describe the resource that produced the spans.
+	ServiceName    string
+	ServiceVersion string
+
+	// Client sends the export requests.
+	Client *http.Client
+}
+
+// NewExporter returns an exporter to the collector at endpoint.
+func NewExporter(endpoint, serviceName, serviceVersion string) *Exporter {
+	return &Exporter{
+		Endpoint:       endpoint,
+		ServiceName:    serviceName,
+		ServiceVersion: serviceVersion,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export sends spans to the collector.
+func (e *Exporter) Export(spans []*Span) error {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, newOTLPSpan(span))
+	}
+
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: otlpAttributes(map[string]interface{}{
+					"service.name":    e.ServiceName,
+					"service.version": e.ServiceVersion,
+				}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: e.ServiceName, Version: e.ServiceVersion},
+				Spans: otlpSpans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(e.Endpoint, "/") + otlpTracesPath
+	resp, err := e.Client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("export of %v spans to %v failed, expected: %v, got: %v %s", len(spans), url, http.StatusOK, resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// OTLP JSON encoding of the trace service request.
+// See: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	// otlpValue is an AnyValue. 64-bit integers are encoded as strings.
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// newOTLPSpan encodes an ended span.
+func newOTLPSpan(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+		Status:            otlpStatus{Code: statusCodeUnset},
+	}
+	if s.ParentID.IsValid() {
+		span.ParentSpanID = s.ParentID.String()
+	}
+	if s.failed {
+		span.Status = otlpStatus{Code: statusCodeError, Message: s.err}
+	}
+	return span
+}
+
+// otlpAttributes encodes attributes sorted by key. Empty strings are omitted.
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var encoded []otlpAttribute
+	for _, key := range keys {
+		var value otlpValue
+		switch v := attributes[key].(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttribute{Key: key, Value: value})
+	}
+	return encoded
+}
@@ -0,0 +1,253 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SpanKind is the kind of a span, as defined by OpenTelemetry.
+type SpanKind int
+
+// Span kinds.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindClient   SpanKind = 3
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns the ID in lowercase hex.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+// String returns the ID in lowercase hex.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid reports whether the ID is set.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Span is a timed operation of a trace. All methods can be called on a nil span, which does nothing, so
+// that tracing can be disabled by not starting a root span.
+type Span struct {
+	tracer *Tracer
+	parent *Span
+
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+	failed     bool
+}
+
+// Child starts a span that is a child of s.
+func (s *Span) Child(name string, kind SpanKind) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer:     s.tracer,
+		parent:     s,
+		TraceID:    s.TraceID,
+		SpanID:     newSpanID(),
+		ParentID:   s.SpanID,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+}
+
+// SetAttribute sets an attribute of the span. Values are strings, bools, integers or floats.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed with the given message.
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.err = msg
+}
+
+// End ends the span, marking it as failed if err is not nil, and queues it for export.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		s.SetError(err.Error())
+	}
+
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.add(s)
+}
+
+// Duration returns the duration of an ended span.
+func (s *Span) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.end.Sub(s.Start)
+}
+
+// Error returns the error message of the span, and whether it failed.
+func (s *Span) Error() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err, s.failed
+}
+
+// Path returns the names of the span and its ancestors, root first.
+func (s *Span) Path() []string {
+	var names []string
+	for span := s; span != nil; span = span.parent {
+		names = append([]string{span.Name}, names...)
+	}
+	return names
+}
+
+// Traceparent returns the W3C trace context header of the span.
+// See: https://www.w3.org/TR/trace-context/#traceparent-header
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%v-%v-01", s.TraceID, s.SpanID)
+}
+
+// Tracer starts traces and exports their ended spans.
+type Tracer struct {
+	exporter *Exporter
+
+	// OnEnd, if set, is called with every span when it ends.
+	OnEnd func(*Span)
+
+	mu    sync.Mutex
+	ended []*Span
+}
+
+// NewTracer returns a tracer exporting spans with exporter. If exporter is nil, spans are not exported but
+// are still passed to OnEnd.
+func NewTracer(exporter *Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start starts the root span of a new trace. It returns nil if t is nil.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	var traceID TraceID
+	randomize(traceID[:])
+
+	return &Span{
+		tracer:     t,
+		TraceID:    traceID,
+		SpanID:     newSpanID(),
+		Name:       name,
+		Kind:       SpanKindInternal,
+		Start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+}
+
+// Flush exports the spans that ended since the last flush.
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans := t.ended
+	t.ended = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	return t.exporter.Export(spans)
+}
+
+// add queues an ended span for export.
+func (t *Tracer) add(s *Span) {
+	if t.OnEnd != nil {
+		t.OnEnd(s)
+	}
+	if t.exporter == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ended = append(t.ended, s)
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	randomize(id[:])
+	return id
+}
+
+// randomize fills b with random bytes.
+func randomize(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// IDs only need to be unique, fall back to the clock.
+		now := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(now >> (8 * (i % 8)))
+		}
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}